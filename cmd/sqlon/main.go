@@ -1,13 +1,21 @@
 package main
 
 import (
+	"bytes"
+	"errors"
+	"flag"
 	"fmt"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"strings"
 
+	"sqlon/internal/diff"
+	"sqlon/internal/format/json"
 	"sqlon/internal/format/sql"
 	"sqlon/internal/format/sqlon"
+	"sqlon/internal/merge"
+	"sqlon/internal/model"
 	"sqlon/internal/pipeline"
 )
 
@@ -20,26 +28,137 @@ func main() {
 
 	switch args[0] {
 	case "to-sql":
+		fs := flag.NewFlagSet("to-sql", flag.ExitOnError)
+		datetime := fs.String("datetime", "iso", "datetime storage: iso or epoch")
+		cascade := fs.Bool("on-delete-cascade", false, "add ON DELETE CASCADE to foreign keys")
+		dialect := fs.String("dialect", "sqlite", "SQL dialect: sqlite, postgres or mysql")
+		upsert := fs.Bool("upsert", false, "emit a script that can be re-applied: CREATE ... IF NOT EXISTS and ON CONFLICT DO UPDATE")
+		batch := fs.Int("batch", 1, "rows per INSERT; above 1 also wraps the script in a transaction")
+		schema := fs.String("schema", "", "schema (postgres) or database (mysql) to qualify table names with")
+		changesFrom := fs.String("changes-from", "", "older SQLON file; emit only the INSERT, UPDATE and DELETE statements that bring its rows up to date")
+		fs.Parse(args[1:])
+		if fs.NArg() != 1 {
+			usage()
+			os.Exit(2)
+		}
+		opts := sql.ExportOptions{OnDeleteCascade: *cascade, BatchSize: *batch, Upsert: *upsert, Schema: *schema}
+		switch sql.Dialect(*dialect) {
+		case sql.DialectSQLite, sql.DialectPostgres, sql.DialectMySQL:
+			opts.Dialect = sql.Dialect(*dialect)
+		default:
+			fmt.Fprintf(os.Stderr, "Error: unknown dialect %q (expected sqlite, postgres or mysql)\n", *dialect)
+			os.Exit(2)
+		}
+		switch *datetime {
+		case "iso":
+			opts.Datetime = sql.DatetimeISO
+		case "epoch":
+			opts.Datetime = sql.DatetimeEpoch
+		default:
+			fmt.Fprintf(os.Stderr, "Error: unknown datetime storage %q (expected iso or epoch)\n", *datetime)
+			os.Exit(2)
+		}
+		if *changesFrom != "" {
+			if err := runChangesToSQL(*changesFrom, fs.Arg(0), opts); err != nil {
+				fmt.Fprintln(os.Stderr, "Error:", err)
+				os.Exit(1)
+			}
+			break
+		}
+		if err := runToSQL(fs.Arg(0), opts); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(1)
+		}
+	case "migrate":
+		fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+		datetime := fs.String("datetime", "iso", "datetime storage the database was created with: iso or epoch")
+		cascade := fs.Bool("on-delete-cascade", false, "the database's foreign keys use ON DELETE CASCADE")
+		fs.Parse(args[1:])
+		if fs.NArg() != 2 {
+			usage()
+			os.Exit(2)
+		}
+		opts := sql.ExportOptions{OnDeleteCascade: *cascade}
+		switch *datetime {
+		case "iso":
+			opts.Datetime = sql.DatetimeISO
+		case "epoch":
+			opts.Datetime = sql.DatetimeEpoch
+		default:
+			fmt.Fprintf(os.Stderr, "Error: unknown datetime storage %q (expected iso or epoch)\n", *datetime)
+			os.Exit(2)
+		}
+		if err := runMigrate(fs.Arg(0), fs.Arg(1), opts); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(1)
+		}
+	case "diff":
+		fs := flag.NewFlagSet("diff", flag.ExitOnError)
+		asJSON := fs.Bool("json", false, "write the changes as JSON")
+		fs.Parse(args[1:])
+		if fs.NArg() != 2 {
+			usage()
+			os.Exit(2)
+		}
+		same, err := runDiff(fs.Arg(0), fs.Arg(1), *asJSON)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(2)
+		}
+		if !same {
+			os.Exit(1)
+		}
+	case "merge-driver":
+		if len(args) != 4 {
+			usage()
+			os.Exit(2)
+		}
+		clean, err := runMergeDriver(args[1], args[2], args[3])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(2)
+		}
+		if !clean {
+			os.Exit(1)
+		}
+	case "validate":
 		if len(args) != 2 {
 			usage()
 			os.Exit(2)
 		}
-		if err := runToSQL(args[1]); err != nil {
+		ok, err := runValidate(args[1])
+		if err != nil {
 			fmt.Fprintln(os.Stderr, "Error:", err)
 			os.Exit(1)
 		}
+		if !ok {
+			os.Exit(1)
+		}
 	case "json-to-sqlon":
-		if len(args) < 2 || len(args) > 3 {
+		fs := flag.NewFlagSet("json-to-sqlon", flag.ExitOnError)
+		detectDatetime := fs.Bool("detect-datetime", false, "import columns of RFC 3339 strings as datetime")
+		schemaPath := fs.String("schema", "", "SQLON file whose column types (blob, datetime) override inference")
+		fs.Parse(args[1:])
+		if fs.NArg() < 1 || fs.NArg() > 2 {
 			usage()
 			os.Exit(2)
 		}
 		output := ""
-		if len(args) == 3 {
-			output = args[2]
+		if fs.NArg() == 2 {
+			output = fs.Arg(1)
 		} else {
-			output = strings.TrimSuffix(args[1], ".json") + ".sqlon"
+			output = strings.TrimSuffix(fs.Arg(0), ".json") + ".sqlon"
+		}
+		opts := json.ImportOptions{DetectDatetime: *detectDatetime}
+		if *schemaPath != "" {
+			schema, err := parseSQLONFile(*schemaPath)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "Error:", err)
+				os.Exit(1)
+			}
+			opts.Schema = schema
 		}
-		if err := runJSONToSQLON(args[1], output); err != nil {
+		if err := runJSONToSQLON(fs.Arg(0), output, opts); err != nil {
 			fmt.Fprintln(os.Stderr, "Error:", err)
 			os.Exit(1)
 		}
@@ -58,6 +177,21 @@ func main() {
 			fmt.Fprintln(os.Stderr, "Error:", err)
 			os.Exit(1)
 		}
+	case "sql-to-sqlon":
+		if len(args) < 2 || len(args) > 3 {
+			usage()
+			os.Exit(2)
+		}
+		output := ""
+		if len(args) == 3 {
+			output = args[2]
+		} else {
+			output = strings.TrimSuffix(args[1], ".sql") + ".sqlon"
+		}
+		if err := runSQLToSQLON(args[1], output); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(1)
+		}
 	case "convert-json":
 		if len(args) != 2 {
 			usage()
@@ -84,28 +218,149 @@ func main() {
 	}
 }
 
-func runToSQL(path string) error {
+func parseSQLONFile(path string) (*model.Database, error) {
 	f, err := os.Open(path)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer f.Close()
 
-	db, err := sqlon.Parse(f)
+	return sqlon.Parse(f)
+}
+
+func runToSQL(path string, opts sql.ExportOptions) error {
+	db, err := parseSQLONFile(path)
 	if err != nil {
 		return err
 	}
 
-	return sql.ExportSQLite(os.Stdout, db)
+	return sql.Export(os.Stdout, db, opts)
 }
 
-func runJSONToSQLON(inputPath, outputPath string) error {
+func runChangesToSQL(fromPath, toPath string, opts sql.ExportOptions) error {
+	from, err := parseSQLONFile(fromPath)
+	if err != nil {
+		return err
+	}
+	to, err := parseSQLONFile(toPath)
+	if err != nil {
+		return err
+	}
+
+	return sql.ExportChanges(os.Stdout, from, to, opts)
+}
+
+func runMigrate(fromPath, toPath string, opts sql.ExportOptions) error {
+	from, err := parseSQLONFile(fromPath)
+	if err != nil {
+		return err
+	}
+	to, err := parseSQLONFile(toPath)
+	if err != nil {
+		return err
+	}
+
+	return sql.ExportMigration(os.Stdout, from, to, opts)
+}
+
+// runDiff reports whether the two files hold the same rows, like diff(1).
+func runDiff(aPath, bPath string, asJSON bool) (bool, error) {
+	a, err := parseSQLONFile(aPath)
+	if err != nil {
+		return false, err
+	}
+	b, err := parseSQLONFile(bPath)
+	if err != nil {
+		return false, err
+	}
+
+	d := diff.Compare(a, b)
+	if asJSON {
+		err = diff.WriteJSON(os.Stdout, d)
+	} else {
+		err = diff.WriteText(os.Stdout, d)
+	}
+	return d.Empty(), err
+}
+
+// runMergeDriver merges the changes made in theirs since base into ours,
+// leaving the result in ours as git expects of a merge driver. It reports
+// whether the merge was clean. When the files can't be merged row by row it
+// falls back to git's line merge.
+func runMergeDriver(basePath, oursPath, theirsPath string) (bool, error) {
+	res, err := mergeFiles(basePath, oursPath, theirsPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "sqlon: %v; falling back to a line merge\n", err)
+		cmd := exec.Command("git", "merge-file", "-L", "ours", "-L", "base", "-L", "theirs", oursPath, basePath, theirsPath)
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			var exit *exec.ExitError
+			if errors.As(err, &exit) && exit.ExitCode() > 0 {
+				// The number of conflicts
+				return false, nil
+			}
+			return false, err
+		}
+		return true, nil
+	}
+
+	var buf bytes.Buffer
+	if err := sqlon.FormatConflicts(&buf, res.Database, res.Conflicts); err != nil {
+		return false, err
+	}
+	if err := os.WriteFile(oursPath, buf.Bytes(), 0o644); err != nil {
+		return false, err
+	}
+	if len(res.Conflicts) > 0 {
+		fmt.Fprintf(os.Stderr, "sqlon: %d conflicting row(s)\n", len(res.Conflicts))
+		return false, nil
+	}
+	return true, nil
+}
+
+func mergeFiles(basePath, oursPath, theirsPath string) (*merge.Result, error) {
+	base, err := os.ReadFile(basePath)
+	if err != nil {
+		return nil, err
+	}
+	ours, err := os.ReadFile(oursPath)
+	if err != nil {
+		return nil, err
+	}
+	theirs, err := os.ReadFile(theirsPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return merge.Files(base, ours, theirs)
+}
+
+func runValidate(path string) (bool, error) {
+	db, err := parseSQLONFile(path)
+	if err != nil {
+		return false, err
+	}
+
+	errs := db.Validate()
+	for _, e := range errs {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", path, e.Error())
+	}
+	if len(errs) > 0 {
+		fmt.Fprintf(os.Stderr, "%d problem(s) found\n", len(errs))
+		return false, nil
+	}
+
+	fmt.Fprintln(os.Stdout, "OK:", path)
+	return true, nil
+}
+
+func runJSONToSQLON(inputPath, outputPath string, opts json.ImportOptions) error {
 	input, err := os.ReadFile(inputPath)
 	if err != nil {
 		return err
 	}
 
-	step := &pipeline.JSONToSQLONStep{}
+	step := &pipeline.JSONToSQLONStep{Options: opts}
 	output, err := step.Run(input)
 	if err != nil {
 		return err
@@ -129,6 +384,21 @@ func runSQLONToJSON(inputPath, outputPath string) error {
 	return os.WriteFile(outputPath, output, 0o644)
 }
 
+func runSQLToSQLON(inputPath, outputPath string) error {
+	input, err := os.ReadFile(inputPath)
+	if err != nil {
+		return err
+	}
+
+	step := &pipeline.SQLToSQLONStep{}
+	output, err := step.Run(input)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(outputPath, output, 0o644)
+}
+
 func runConvertJSON(jsonPath string) error {
 	// Read original JSON
 	input, err := os.ReadFile(jsonPath)
@@ -227,12 +497,22 @@ func usage() {
 	fmt.Fprintln(os.Stderr, "SQLON (Phase 1)")
 	fmt.Fprintln(os.Stderr, "")
 	fmt.Fprintln(os.Stderr, "Usage:")
-	fmt.Fprintln(os.Stderr, "    sqlon to-sql <file.sqlon>")
-	fmt.Fprintln(os.Stderr, "    sqlon json-to-sqlon <input.json> [output.sqlon]")
+	fmt.Fprintln(os.Stderr, "    sqlon to-sql [--dialect sqlite|postgres|mysql] [--schema name] [--datetime iso|epoch] [--on-delete-cascade] [--batch N] [--upsert] [--changes-from old.sqlon] <file.sqlon>")
+	fmt.Fprintln(os.Stderr, "    sqlon migrate [--datetime iso|epoch] [--on-delete-cascade] <old.sqlon> <new.sqlon>")
+	fmt.Fprintln(os.Stderr, "    sqlon diff [--json] <a.sqlon> <b.sqlon>")
+	fmt.Fprintln(os.Stderr, "    sqlon merge-driver <base> <ours> <theirs>")
+	fmt.Fprintln(os.Stderr, "    sqlon validate <file.sqlon>")
+	fmt.Fprintln(os.Stderr, "    sqlon json-to-sqlon [--detect-datetime] [--schema schema.sqlon] <input.json> [output.sqlon]")
 	fmt.Fprintln(os.Stderr, "    sqlon sqlon-to-json <input.sqlon> [output.json]")
+	fmt.Fprintln(os.Stderr, "    sqlon sql-to-sqlon <input.sql> [output.sqlon]")
 	fmt.Fprintln(os.Stderr, "    sqlon convert-json <input.json>")
 	fmt.Fprintln(os.Stderr, "    sqlon roundtrip <file.json>")
 	fmt.Fprintln(os.Stderr, "")
+	fmt.Fprintln(os.Stderr, "migrate:      Writes the SQLite DDL that moves the old schema to the new one")
+	fmt.Fprintln(os.Stderr, "diff:         Lists inserted, deleted and updated rows; exits 1 when they differ")
+	fmt.Fprintln(os.Stderr, "merge-driver: Three-way merges rows by primary key into <ours>, for git's %O %A %B")
+	fmt.Fprintln(os.Stderr, "validate:     Checks rows against the schema; exits non-zero on any problem")
+	fmt.Fprintln(os.Stderr, "sql-to-sqlon: Imports SQLite SQL, including sqlite3 .dump output")
 	fmt.Fprintln(os.Stderr, "convert-json: Converts JSON → SQLON → JSON, preserving original")
 	fmt.Fprintln(os.Stderr, "             Outputs: examples/sqlon/<name>.sqlon")
 	fmt.Fprintln(os.Stderr, "                      examples/json/<name>.roundtrip.json")
@@ -0,0 +1,159 @@
+// Package diff compares the rows of two databases table by table.
+package diff
+
+import (
+	"slices"
+
+	"sqlon/internal/model"
+)
+
+// Diff lists the row changes that turn one database into another. Tables
+// without changes are left out.
+type Diff struct {
+	Tables []*TableDiff
+}
+
+// TableDiff holds the changes to one table. Inserted rows are laid out like
+// New's columns and deleted rows like Old's. A table present on one side
+// only has all of its rows inserted or deleted.
+type TableDiff struct {
+	Name string
+
+	// Old and New are the table in each database; either is nil when the
+	// table exists on one side only.
+	Old, New *model.Table
+
+	// Key names the columns rows were matched on: the primary key, or
+	// every shared column when the table has none.
+	Key   []string
+	Keyed bool
+
+	Inserted []model.Row
+	Deleted  []model.Row
+	Updated  []RowUpdate
+}
+
+// RowUpdate is a row whose key is in both databases but whose other values
+// differ.
+type RowUpdate struct {
+	Old, New model.Row
+
+	// Changed names the columns whose values differ, in New's order.
+	Changed []string
+}
+
+// Empty reports whether the databases hold the same rows.
+func (d *Diff) Empty() bool {
+	return len(d.Tables) == 0
+}
+
+// Table returns the changes to the named table, if there are any.
+func (d *Diff) Table(name string) (*TableDiff, bool) {
+	for _, t := range d.Tables {
+		if t.Name == name {
+			return t, true
+		}
+	}
+	return nil, false
+}
+
+func (t *TableDiff) empty() bool {
+	return len(t.Inserted) == 0 && len(t.Deleted) == 0 && len(t.Updated) == 0
+}
+
+// Compare matches the rows of each table in a against those in b.
+//
+// Rows are matched on the primary key when both versions of a table share
+// it, so a row whose other values change is reported as updated. Otherwise
+// a row is identified by all of its values, and a changed row shows up as
+// one deletion and one insertion. Only columns present in both versions
+// are compared; columns added or dropped in between are a schema change,
+// not a row change.
+func Compare(a, b *model.Database) *Diff {
+	d := &Diff{}
+	for _, nt := range b.Tables {
+		ot, _ := a.TableByName(nt.Name)
+		if td := compareTable(ot, nt); !td.empty() {
+			d.Tables = append(d.Tables, td)
+		}
+	}
+	for _, ot := range a.Tables {
+		if _, ok := b.TableByName(ot.Name); ok {
+			continue
+		}
+		if td := compareTable(ot, nil); !td.empty() {
+			d.Tables = append(d.Tables, td)
+		}
+	}
+	return d
+}
+
+func compareTable(ot, nt *model.Table) *TableDiff {
+	switch {
+	case ot == nil:
+		return &TableDiff{Name: nt.Name, New: nt, Key: nt.PK, Keyed: len(nt.PK) > 0, Inserted: nt.Rows}
+	case nt == nil:
+		return &TableDiff{Name: ot.Name, Old: ot, Key: ot.PK, Keyed: len(ot.PK) > 0, Deleted: ot.Rows}
+	}
+
+	td := &TableDiff{Name: nt.Name, Old: ot, New: nt}
+
+	// The columns both versions share, in the new order
+	var shared []string
+	var oldShared, newShared []int
+	for ni, c := range nt.Columns {
+		if oi, ok := ot.ColumnIndex(c.Name); ok {
+			shared = append(shared, c.Name)
+			oldShared = append(oldShared, oi)
+			newShared = append(newShared, ni)
+		}
+	}
+
+	oldKey, oldOK := ot.PKIndexes()
+	newKey, newOK := nt.PKIndexes()
+	if oldOK && newOK && slices.Equal(ot.PK, nt.PK) {
+		td.Key, td.Keyed = nt.PK, true
+	} else {
+		td.Key, oldKey, newKey = shared, oldShared, newShared
+	}
+
+	// Rows sharing a key are paired in order, so duplicates in a table
+	// without a primary key are matched one for one
+	pending := make(map[string][]int)
+	for i, row := range ot.Rows {
+		k := model.RowKey(row, oldKey)
+		pending[k] = append(pending[k], i)
+	}
+	matched := make([]bool, len(ot.Rows))
+	for _, row := range nt.Rows {
+		k := model.RowKey(row, newKey)
+		queue := pending[k]
+		if len(queue) == 0 {
+			td.Inserted = append(td.Inserted, row)
+			continue
+		}
+		oi := queue[0]
+		pending[k] = queue[1:]
+		matched[oi] = true
+
+		if !td.Keyed {
+			continue
+		}
+		var changed []string
+		for n, name := range shared {
+			if ot.Rows[oi].At(oldShared[n]).Key() != row.At(newShared[n]).Key() {
+				changed = append(changed, name)
+			}
+		}
+		if len(changed) > 0 {
+			td.Updated = append(td.Updated, RowUpdate{Old: ot.Rows[oi], New: row, Changed: changed})
+		}
+	}
+	for i, row := range ot.Rows {
+		if !matched[i] {
+			td.Deleted = append(td.Deleted, row)
+		}
+	}
+
+	return td
+}
@@ -0,0 +1,153 @@
+package diff
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"sqlon/internal/model"
+)
+
+func postsTable(rows ...model.Row) *model.Table {
+	return &model.Table{
+		Name: "posts",
+		Columns: []model.Column{
+			{Name: "id", Type: model.ColumnTypeInt},
+			{Name: "title", Type: model.ColumnTypeText},
+			{Name: "price", Type: model.ColumnTypeDecimal},
+		},
+		PK:   []string{"id"},
+		Rows: rows,
+	}
+}
+
+func post(id int64, title, price string) model.Row {
+	return model.Row{model.IntValue(id), model.TextValue(title), model.DecimalValue(model.Decimal(price))}
+}
+
+func TestCompareByPrimaryKey(t *testing.T) {
+	a := &model.Database{Tables: []*model.Table{postsTable(post(1, "Draft", "1.5"), post(2, "Gone", "2"), post(4, "Same", "3"))}}
+	b := &model.Database{Tables: []*model.Table{postsTable(post(4, "Same", "3.00"), post(1, "Final", "1.5"), post(3, "New", "1"))}}
+
+	d := Compare(a, b)
+	td, ok := d.Table("posts")
+	if !ok {
+		t.Fatal("expected changes to posts")
+	}
+	if !reflect.DeepEqual(td.Inserted, []model.Row{post(3, "New", "1")}) {
+		t.Errorf("inserted = %v", td.Inserted)
+	}
+	if !reflect.DeepEqual(td.Deleted, []model.Row{post(2, "Gone", "2")}) {
+		t.Errorf("deleted = %v", td.Deleted)
+	}
+	// Decimals compare by value, so 3 and 3.00 are unchanged
+	want := []RowUpdate{{Old: post(1, "Draft", "1.5"), New: post(1, "Final", "1.5"), Changed: []string{"title"}}}
+	if !reflect.DeepEqual(td.Updated, want) {
+		t.Errorf("updated = %+v, want %+v", td.Updated, want)
+	}
+}
+
+func TestCompareWithoutPrimaryKey(t *testing.T) {
+	tags := func(values ...string) *model.Database {
+		table := &model.Table{Name: "tags", Columns: []model.Column{{Name: "tag", Type: model.ColumnTypeText}}}
+		for _, v := range values {
+			table.Rows = append(table.Rows, model.Row{model.TextValue(v)})
+		}
+		return &model.Database{Tables: []*model.Table{table}}
+	}
+
+	d := Compare(tags("a", "b", "b"), tags("b", "c"))
+	td, _ := d.Table("tags")
+	if td.Keyed {
+		t.Error("expected a table without a primary key to be matched on whole rows")
+	}
+	if !reflect.DeepEqual(td.Inserted, []model.Row{{model.TextValue("c")}}) {
+		t.Errorf("inserted = %v", td.Inserted)
+	}
+	// Only one of the duplicate rows is matched
+	if !reflect.DeepEqual(td.Deleted, []model.Row{{model.TextValue("a")}, {model.TextValue("b")}}) {
+		t.Errorf("deleted = %v", td.Deleted)
+	}
+	if len(td.Updated) != 0 {
+		t.Errorf("unexpected updates: %v", td.Updated)
+	}
+}
+
+func TestCompareTablesOnOneSide(t *testing.T) {
+	a := &model.Database{Tables: []*model.Table{postsTable(post(1, "Old", "1"))}}
+	b := &model.Database{Tables: []*model.Table{{Name: "tags", Columns: []model.Column{{Name: "tag", Type: model.ColumnTypeText}}, Rows: []model.Row{{model.TextValue("x")}}}}}
+
+	d := Compare(a, b)
+	if len(d.Tables) != 2 || d.Tables[0].Name != "tags" || d.Tables[1].Name != "posts" {
+		t.Fatalf("unexpected tables: %+v", d.Tables)
+	}
+	if len(d.Tables[0].Inserted) != 1 || d.Tables[0].Old != nil {
+		t.Errorf("expected the new table's row inserted: %+v", d.Tables[0])
+	}
+	if len(d.Tables[1].Deleted) != 1 || d.Tables[1].New != nil {
+		t.Errorf("expected the dropped table's row deleted: %+v", d.Tables[1])
+	}
+}
+
+func TestCompareIgnoresAddedColumns(t *testing.T) {
+	a := &model.Database{Tables: []*model.Table{postsTable(post(1, "Same", "1"))}}
+	wider := postsTable(append(post(1, "Same", "1"), model.BoolValue(true)))
+	wider.Columns = append(wider.Columns, model.Column{Name: "published", Type: model.ColumnTypeBool})
+	b := &model.Database{Tables: []*model.Table{wider}}
+
+	if d := Compare(a, b); !d.Empty() {
+		t.Errorf("expected no row changes, got %+v", d.Tables[0])
+	}
+}
+
+func TestWriteText(t *testing.T) {
+	a := &model.Database{Tables: []*model.Table{postsTable(post(1, "Draft", "1"), post(2, "Gone", "2"))}}
+	b := &model.Database{Tables: []*model.Table{postsTable(post(1, "Final", "1.25"), post(3, "New", "3"))}}
+
+	var buf bytes.Buffer
+	if err := WriteText(&buf, Compare(a, b)); err != nil {
+		t.Fatal(err)
+	}
+	want := `posts: 1 inserted, 1 deleted, 1 updated
+  + id=3, title="New", price=3
+  - id=2, title="Gone", price=2
+  ~ id=1: title "Draft" -> "Final", price 1 -> 1.25
+`
+	if buf.String() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	a := &model.Database{Tables: []*model.Table{postsTable(post(1, "Draft", "1"))}}
+	b := &model.Database{Tables: []*model.Table{postsTable(post(1, "Final", "1"), post(2, "New", "2.50"))}}
+
+	var buf bytes.Buffer
+	if err := WriteJSON(&buf, Compare(a, b)); err != nil {
+		t.Fatal(err)
+	}
+
+	var got map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, buf.String())
+	}
+	want := map[string]interface{}{
+		"tables": []interface{}{
+			map[string]interface{}{
+				"table":    "posts",
+				"key":      []interface{}{"id"},
+				"keyed":    true,
+				"inserted": []interface{}{map[string]interface{}{"id": 2.0, "title": "New", "price": 2.5}},
+				"deleted":  []interface{}{},
+				"updated": []interface{}{map[string]interface{}{
+					"key":     map[string]interface{}{"id": 1.0},
+					"changes": map[string]interface{}{"title": map[string]interface{}{"old": "Draft", "new": "Final"}},
+				}},
+			},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got:\n%s", buf.String())
+	}
+}
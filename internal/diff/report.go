@@ -0,0 +1,147 @@
+package diff
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	jsonformat "sqlon/internal/format/json"
+	"sqlon/internal/model"
+)
+
+// WriteText writes d for people to read: a summary line per table, then a
+// line per row. Inserted rows start with "+", deleted ones with "-", and
+// updated ones with "~" followed by their key and the changed values.
+//
+//	posts: 1 inserted, 0 deleted, 1 updated
+//	  + id=3, title="Hello"
+//	  ~ id=1: title "Draft" -> "Final"
+func WriteText(w io.Writer, d *Diff) error {
+	var b strings.Builder
+	for _, t := range d.Tables {
+		fmt.Fprintf(&b, "%s: %d inserted, %d deleted, %d updated\n", t.Name, len(t.Inserted), len(t.Deleted), len(t.Updated))
+		for _, row := range t.Inserted {
+			fmt.Fprintf(&b, "  + %s\n", formatRow(t.New, row))
+		}
+		for _, row := range t.Deleted {
+			fmt.Fprintf(&b, "  - %s\n", formatRow(t.Old, row))
+		}
+		for _, u := range t.Updated {
+			changes := make([]string, 0, len(u.Changed))
+			for _, name := range u.Changed {
+				changes = append(changes, fmt.Sprintf("%s %s -> %s", name, column(t.Old, u.Old, name), column(t.New, u.New, name)))
+			}
+			fmt.Fprintf(&b, "  ~ %s: %s\n", formatKey(t, u.New), strings.Join(changes, ", "))
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// formatRow renders row as name=value pairs in column order.
+func formatRow(t *model.Table, row model.Row) string {
+	pairs := make([]string, 0, len(t.Columns))
+	for i, c := range t.Columns {
+		pairs = append(pairs, c.Name+"="+row.At(i).String())
+	}
+	return strings.Join(pairs, ", ")
+}
+
+func formatKey(t *TableDiff, row model.Row) string {
+	pairs := make([]string, 0, len(t.Key))
+	for _, name := range t.Key {
+		pairs = append(pairs, name+"="+column(t.New, row, name).String())
+	}
+	return strings.Join(pairs, ", ")
+}
+
+// column returns the value of the named column in row, or null if t has no
+// such column.
+func column(t *model.Table, row model.Row, name string) model.Value {
+	i, ok := t.ColumnIndex(name)
+	if !ok {
+		return model.NullValue()
+	}
+	return row.At(i)
+}
+
+type jsonDiff struct {
+	Tables []jsonTable `json:"tables"`
+}
+
+type jsonTable struct {
+	Table    string                   `json:"table"`
+	Key      []string                 `json:"key"`
+	Keyed    bool                     `json:"keyed"`
+	Inserted []map[string]interface{} `json:"inserted"`
+	Deleted  []map[string]interface{} `json:"deleted"`
+	Updated  []jsonUpdate             `json:"updated"`
+}
+
+type jsonUpdate struct {
+	Key     map[string]interface{} `json:"key"`
+	Changes map[string]jsonChange  `json:"changes"`
+}
+
+type jsonChange struct {
+	Old interface{} `json:"old"`
+	New interface{} `json:"new"`
+}
+
+// WriteJSON writes d as a JSON document:
+//
+//	{"tables": [{"table": "posts", "key": ["id"], "keyed": true,
+//	  "inserted": [{"id": 3, "title": "Hello"}], "deleted": [],
+//	  "updated": [{"key": {"id": 1}, "changes": {"title": {"old": "Draft", "new": "Final"}}}]}]}
+//
+// Rows are objects keyed by column name. Values are written as by the JSON
+// exporter: datetimes as RFC 3339 strings and blobs as base64.
+func WriteJSON(w io.Writer, d *Diff) error {
+	out := jsonDiff{Tables: make([]jsonTable, 0, len(d.Tables))}
+	for _, t := range d.Tables {
+		jt := jsonTable{
+			Table:    t.Name,
+			Key:      t.Key,
+			Keyed:    t.Keyed,
+			Inserted: make([]map[string]interface{}, 0, len(t.Inserted)),
+			Deleted:  make([]map[string]interface{}, 0, len(t.Deleted)),
+			Updated:  make([]jsonUpdate, 0, len(t.Updated)),
+		}
+		if jt.Key == nil {
+			jt.Key = []string{}
+		}
+		for _, row := range t.Inserted {
+			jt.Inserted = append(jt.Inserted, rowObject(t.New, row))
+		}
+		for _, row := range t.Deleted {
+			jt.Deleted = append(jt.Deleted, rowObject(t.Old, row))
+		}
+		for _, u := range t.Updated {
+			ju := jsonUpdate{Key: make(map[string]interface{}), Changes: make(map[string]jsonChange)}
+			for _, name := range t.Key {
+				ju.Key[name] = jsonformat.ExportValue(column(t.New, u.New, name))
+			}
+			for _, name := range u.Changed {
+				ju.Changes[name] = jsonChange{Old: jsonformat.ExportValue(column(t.Old, u.Old, name)), New: jsonformat.ExportValue(column(t.New, u.New, name))}
+			}
+			jt.Updated = append(jt.Updated, ju)
+		}
+		out.Tables = append(out.Tables, jt)
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "    ")
+	if err := encoder.Encode(out); err != nil {
+		return fmt.Errorf("failed to encode JSON: %w", err)
+	}
+	return nil
+}
+
+func rowObject(t *model.Table, row model.Row) map[string]interface{} {
+	obj := make(map[string]interface{}, len(t.Columns))
+	for i, c := range t.Columns {
+		obj[c.Name] = jsonformat.ExportValue(row.At(i))
+	}
+	return obj
+}
@@ -1,6 +1,7 @@
 package json
 
 import (
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -110,29 +111,17 @@ func exportTableRows(table *model.Table, childTables []*model.Table, tableMap ma
 	for rowIndex, row := range table.Rows {
 		rowObj := make(map[string]interface{})
 
-		// Get row ID (using row index + 1, or from id column if exists)
-		rowId := rowIndex + 1
-		if len(table.Columns) > 0 {
-			// Check if first column is an id column
-			for i, colName := range colNames {
-				if colName == "id" && i < len(row) && row[i].Kind == model.ValueKindInt {
-					rowId = int(row[i].Int64)
-					break
-				}
-			}
-		}
-
 		// Add flat field values (parent tables don't have FK columns)
-		// Skip internal columns like _id
+		// Skip internal columns like _id and generated keys
 		for i, colName := range colNames {
 			// Skip internal _id columns
-			if colName == "_id" {
+			if colName == "_id" || table.Columns[i].Generated {
 				continue
 			}
 
 			var val interface{}
 			if i < len(row) {
-				val = modelValueToJSONValue(row[i])
+				val = ExportValue(row[i])
 			} else {
 				val = nil
 			}
@@ -145,7 +134,14 @@ func exportTableRows(table *model.Table, childTables []*model.Table, tableMap ma
 				continue
 			}
 
-			fkColIdx := 0 // FK is first column in child table
+			fk := childTable.ForeignKeys[0]
+			fkColIdx, _ := childTable.ColumnIndex(fk.Name)
+
+			// Get row ID (from the column the child references, or using row index + 1)
+			rowId := rowIndex + 1
+			if i, ok := table.ColumnIndex(fk.ReferencedColumn); ok && i < len(row) && row[i].Kind == model.ValueKindInt {
+				rowId = int(row[i].Int64)
+			}
 
 			// Extract field name from child table name (e.g., "settings_color_duotone_colors" -> "colors")
 			fieldName := strings.TrimPrefix(childTable.Name, table.Name+"_")
@@ -197,14 +193,14 @@ func buildChildRowObject(childTable *model.Table, childRow model.Row, fkColIdx i
 	colNames := childTable.ColumnNames()
 
 	for i, colName := range colNames {
-		// Skip FK column
-		if i == fkColIdx {
+		// Skip FK column and generated key
+		if i == fkColIdx || childTable.Columns[i].Generated {
 			continue
 		}
 
 		var val interface{}
 		if i < len(childRow) {
-			val = modelValueToJSONValue(childRow[i])
+			val = ExportValue(childRow[i])
 		} else {
 			val = nil
 		}
@@ -231,18 +227,25 @@ func getNonFKColumns(table *model.Table) []model.Column {
 	return nonFKCols
 }
 
-func modelValueToJSONValue(v model.Value) interface{} {
+// ExportValue returns v as Export writes it: decimals as their exact
+// literal, datetimes in RFC 3339 and blobs in base64.
+func ExportValue(v model.Value) interface{} {
 	switch v.Kind {
 	case model.ValueKindNull:
 		return nil
 	case model.ValueKindInt:
 		return v.Int64
 	case model.ValueKindDecimal:
-		return v.Float64
+		// json.Number is written verbatim, keeping the exact literal
+		return json.Number(v.Decimal.String())
 	case model.ValueKindBool:
 		return v.Bool
 	case model.ValueKindText:
 		return v.Text
+	case model.ValueKindDatetime:
+		return model.FormatDatetime(v.Time)
+	case model.ValueKindBlob:
+		return base64.StdEncoding.EncodeToString(v.Bytes)
 	default:
 		return nil
 	}
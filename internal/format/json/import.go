@@ -2,6 +2,7 @@ package json
 
 import (
 	"bytes"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -12,7 +13,23 @@ import (
 	"sqlon/internal/model"
 )
 
+type ImportOptions struct {
+	// DetectDatetime types a text column as datetime when every non-null
+	// value in it parses as an RFC 3339 timestamp. A column mixing
+	// timestamps with other strings stays text.
+	DetectDatetime bool
+
+	// Schema, when set, supplies column types that JSON cannot express.
+	// Text values in columns the schema declares as blob are decoded from
+	// base64, and those declared as datetime are parsed as RFC 3339.
+	Schema *model.Database
+}
+
 func Import(r io.Reader) (*model.Database, error) {
+	return ImportWithOptions(r, ImportOptions{})
+}
+
+func ImportWithOptions(r io.Reader, opts ImportOptions) (*model.Database, error) {
 	// Read the entire JSON to parse it twice: once to get key order, once to decode
 	jsonBytes, err := io.ReadAll(r)
 	if err != nil {
@@ -22,11 +39,17 @@ func Import(r io.Reader) (*model.Database, error) {
 	// First pass: extract root-level key order by parsing tokens
 	rootPrimitiveKeys := extractRootKeyOrder(jsonBytes)
 
-	// Second pass: decode normally
+	// Second pass: decode normally, keeping numbers as their literal text so
+	// that large integers and exact decimals are not rounded through float64
 	var data interface{}
-	if err := json.Unmarshal(jsonBytes, &data); err != nil {
+	decoder := json.NewDecoder(bytes.NewReader(jsonBytes))
+	decoder.UseNumber()
+	if err := decoder.Decode(&data); err != nil {
 		return nil, fmt.Errorf("failed to decode JSON: %w", err)
 	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, fmt.Errorf("failed to decode JSON: unexpected data after top-level value")
+	}
 
 	db := &model.Database{}
 	normalizer := &normalizer{
@@ -120,9 +143,169 @@ func Import(r io.Reader) (*model.Database, error) {
 		db.Tables = append(db.Tables, table)
 	}
 
+	// Child tables are always joined to their parent through the FK column.
+	// Links to the JSON root have no table to join, so they get no index.
+	for _, table := range db.Tables {
+		for _, fk := range table.ForeignKeys {
+			if fk.ReferencedTable == "" {
+				continue
+			}
+			table.Indexes = append(table.Indexes, model.Index{
+				Name:    "idx_" + table.Name + "_" + fk.Name,
+				Columns: []string{fk.Name},
+			})
+		}
+	}
+
+	addParentKeys(db)
+
+	if opts.DetectDatetime {
+		detectDatetimes(db)
+	}
+
+	if opts.Schema != nil {
+		if err := applySchema(db, opts.Schema); err != nil {
+			return nil, err
+		}
+	}
+
 	return db, nil
 }
 
+// addParentKeys gives every table that child tables link to a primary key
+// their <parent>_id columns join on. Children hold their parent row's
+// position, counting from 1. A parent whose own id values are distinct
+// integers keeps them as its key, and its children's positions are
+// rewritten to match. Any other parent gets a column holding exactly the
+// positions, marked as generated: id, or id_2, id_3 and so on when the
+// objects have an id of their own that can't be the key. The children's
+// foreign keys name whichever column that is.
+func addParentKeys(db *model.Database) {
+	for _, table := range db.Tables {
+		var children []*model.Table
+		for _, other := range db.Tables {
+			for _, fk := range other.ForeignKeys {
+				if fk.ReferencedTable == table.Name {
+					children = append(children, other)
+				}
+			}
+		}
+		if len(children) == 0 {
+			continue
+		}
+
+		if i, exists := table.ColumnIndex("id"); exists {
+			if ids, ok := distinctIDs(table, i); ok {
+				table.PK = []string{"id"}
+				for _, child := range children {
+					for _, fk := range child.ForeignKeys {
+						if fk.ReferencedTable != table.Name {
+							continue
+						}
+						ci, _ := child.ColumnIndex(fk.Name)
+						for _, row := range child.Rows {
+							if ci < len(row) && row[ci].Kind == model.ValueKindInt && row[ci].Int64 >= 1 && row[ci].Int64 <= int64(len(ids)) {
+								row[ci] = model.IntValue(ids[row[ci].Int64-1])
+							}
+						}
+					}
+				}
+				continue
+			}
+		}
+
+		key := "id"
+		for n := 2; ; n++ {
+			if _, taken := table.ColumnIndex(key); !taken {
+				break
+			}
+			key = fmt.Sprintf("id_%d", n)
+		}
+		table.Columns = append([]model.Column{{Name: key, Type: model.ColumnTypeInt, Generated: true}}, table.Columns...)
+		for ri, row := range table.Rows {
+			table.Rows[ri] = append(model.Row{model.IntValue(int64(ri + 1))}, row...)
+		}
+		table.PK = []string{key}
+		for _, child := range children {
+			for fi, fk := range child.ForeignKeys {
+				if fk.ReferencedTable == table.Name {
+					child.ForeignKeys[fi].ReferencedColumn = key
+				}
+			}
+		}
+	}
+}
+
+// distinctIDs returns the values of column i of t, if every row holds a
+// different integer there.
+func distinctIDs(t *model.Table, i int) ([]int64, bool) {
+	ids := make([]int64, 0, len(t.Rows))
+	seen := make(map[int64]bool, len(t.Rows))
+	for _, row := range t.Rows {
+		if i >= len(row) || row[i].Kind != model.ValueKindInt || seen[row[i].Int64] {
+			return nil, false
+		}
+		seen[row[i].Int64] = true
+		ids = append(ids, row[i].Int64)
+	}
+	return ids, true
+}
+
+// applySchema retypes columns of db that schema declares as blob or
+// datetime, converting their text values accordingly.
+func applySchema(db *model.Database, schema *model.Database) error {
+	for _, table := range db.Tables {
+		schemaTable, ok := schema.TableByName(table.Name)
+		if !ok {
+			continue
+		}
+
+		for ci, col := range table.Columns {
+			si, ok := schemaTable.ColumnIndex(col.Name)
+			if !ok {
+				continue
+			}
+			want := schemaTable.Columns[si].Type
+			if want != model.ColumnTypeBlob && want != model.ColumnTypeDatetime {
+				continue
+			}
+
+			for ri, row := range table.Rows {
+				if ci >= len(row) || row[ci].Kind != model.ValueKindText {
+					continue
+				}
+				v, err := convertText(row[ci].Text, want)
+				if err != nil {
+					return fmt.Errorf("table %q row %d column %q: %w", table.Name, ri+1, col.Name, err)
+				}
+				row[ci] = v
+			}
+			table.Columns[ci].Type = want
+		}
+	}
+
+	return nil
+}
+
+func convertText(s string, typ model.ColumnType) (model.Value, error) {
+	switch typ {
+	case model.ColumnTypeBlob:
+		b, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			return model.Value{}, fmt.Errorf("invalid base64 for blob: %w", err)
+		}
+		return model.BlobValue(b), nil
+	case model.ColumnTypeDatetime:
+		t, err := model.ParseDatetime(s)
+		if err != nil {
+			return model.Value{}, fmt.Errorf("invalid datetime: %w", err)
+		}
+		return model.DatetimeValue(t), nil
+	default:
+		return model.TextValue(s), nil
+	}
+}
+
 type normalizer struct {
 	tables  map[string]*model.Table
 	counter int
@@ -382,7 +565,7 @@ func (n *normalizer) createTableFromArray(tableName string, arr []interface{}, p
 			table.ForeignKeys = append(table.ForeignKeys, model.ForeignKey{
 				Name:             fkColName,
 				ReferencedTable:  parentTableName,
-				ReferencedColumn: "id", // Assuming parent has id column (will need auto-generated PK)
+				ReferencedColumn: "id", // Generated by addParentKeys if the parent has none
 			})
 		}
 
@@ -401,9 +584,9 @@ func (n *normalizer) createTableFromArray(tableName string, arr []interface{}, p
 			row = make(model.Row, len(columns))
 			colIdx := 0
 
-			// Add FK value if this is a child table (for now, use row index as ID)
+			// The parent is a single object, so every item links to its one row
 			if parentTableName != "" {
-				row[colIdx] = model.IntValue(int64(rowIndex + 1))
+				row[colIdx] = model.IntValue(1)
 				colIdx++
 			}
 
@@ -449,7 +632,7 @@ func (n *normalizer) createTableFromArray(tableName string, arr []interface{}, p
 			row = make(model.Row, len(columns))
 			colIdx := 0
 			if parentTableName != "" {
-				row[colIdx] = model.IntValue(int64(rowIndex + 1))
+				row[colIdx] = model.IntValue(1)
 				colIdx++
 			}
 			if colIdx < len(row) {
@@ -790,15 +973,52 @@ func skipArray(decoder *json.Decoder) {
 	decoder.Token() // consume closing ']'
 }
 
+// detectDatetimes retypes the text columns of db whose non-null values all
+// parse as RFC 3339 timestamps, converting those values to datetimes.
+func detectDatetimes(db *model.Database) {
+	for _, table := range db.Tables {
+		for ci, col := range table.Columns {
+			if col.Type != model.ColumnTypeText || !allDatetimes(table, ci) {
+				continue
+			}
+			for _, row := range table.Rows {
+				if ci < len(row) && row[ci].Kind == model.ValueKindText {
+					t, _ := model.ParseDatetime(row[ci].Text)
+					row[ci] = model.DatetimeValue(t)
+				}
+			}
+			table.Columns[ci].Type = model.ColumnTypeDatetime
+		}
+	}
+}
+
+// allDatetimes reports whether column ci of table holds at least one
+// timestamp and nothing else but nulls.
+func allDatetimes(table *model.Table, ci int) bool {
+	found := false
+	for _, row := range table.Rows {
+		if ci >= len(row) || row[ci].Kind == model.ValueKindNull {
+			continue
+		}
+		if row[ci].Kind != model.ValueKindText {
+			return false
+		}
+		if _, err := model.ParseDatetime(row[ci].Text); err != nil {
+			return false
+		}
+		found = true
+	}
+	return found
+}
+
 func inferType(val interface{}) model.ColumnType {
 	if val == nil {
 		return model.ColumnTypeNull
 	}
 
 	switch v := val.(type) {
-	case float64:
-		// JSON numbers are always float64, check if it's an integer
-		if v == float64(int64(v)) {
+	case json.Number:
+		if jsonNumberToModelValue(v).Kind == model.ValueKindInt {
 			return model.ColumnTypeInt
 		}
 		return model.ColumnTypeDecimal
@@ -817,12 +1037,8 @@ func jsonValueToModelValue(val interface{}) model.Value {
 	}
 
 	switch v := val.(type) {
-	case float64:
-		// Check if it's an integer
-		if v == float64(int64(v)) {
-			return model.IntValue(int64(v))
-		}
-		return model.DecimalValue(v)
+	case json.Number:
+		return jsonNumberToModelValue(v)
 	case bool:
 		return model.BoolValue(v)
 	case string:
@@ -831,3 +1047,16 @@ func jsonValueToModelValue(val interface{}) model.Value {
 		return model.NullValue()
 	}
 }
+
+// jsonNumberToModelValue classifies a number by its literal text: a plain
+// integer that fits in int64 is an int, anything else (a fraction, an
+// exponent, or an integer too large for int64) is an exact decimal.
+func jsonNumberToModelValue(n json.Number) model.Value {
+	lit := n.String()
+	if !strings.ContainsAny(lit, ".eE") {
+		if i, err := strconv.ParseInt(lit, 10, 64); err == nil {
+			return model.IntValue(i)
+		}
+	}
+	return model.DecimalValue(model.Decimal(lit))
+}
@@ -0,0 +1,341 @@
+package json
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"sqlon/internal/format/sqlon"
+	"sqlon/internal/model"
+)
+
+func TestImportPreservesNumberPrecision(t *testing.T) {
+	f, err := os.Open("../../../examples/json/08-large-ids-and-number-forms.json")
+	if err != nil {
+		t.Fatalf("open example: %v", err)
+	}
+	defer f.Close()
+
+	db, err := Import(f)
+	if err != nil {
+		t.Fatalf("import: %v", err)
+	}
+
+	posts, ok := db.TableByName("posts")
+	if !ok {
+		t.Fatalf("missing posts table")
+	}
+
+	want := map[string]model.Value{
+		"id":           model.IntValue(9007199254740993),
+		"parentId":     model.IntValue(9223372036854775807),
+		"negativeZero": model.IntValue(0),
+		"oneDotZero":   model.DecimalValue("1.0"),
+		"exponent":     model.DecimalValue("1e3"),
+		"beyondInt64":  model.DecimalValue("18446744073709551616"),
+	}
+	wantTypes := map[string]model.ColumnType{
+		"id":           model.ColumnTypeInt,
+		"parentId":     model.ColumnTypeInt,
+		"negativeZero": model.ColumnTypeInt,
+		"oneDotZero":   model.ColumnTypeDecimal,
+		"exponent":     model.ColumnTypeDecimal,
+		"beyondInt64":  model.ColumnTypeDecimal,
+	}
+
+	for name, w := range want {
+		i, ok := posts.ColumnIndex(name)
+		if !ok {
+			t.Errorf("missing column %s", name)
+			continue
+		}
+		if got := posts.Columns[i].Type; got != wantTypes[name] {
+			t.Errorf("column %s: expected type %s, got %s", name, wantTypes[name], got)
+		}
+		if got := posts.Rows[0][i]; got.Key() != w.Key() || got.String() != w.String() {
+			t.Errorf("column %s: expected %s %s, got %s %s", name, w.Kind, w, got.Kind, got)
+		}
+	}
+}
+
+const nestedJSON = `{
+    "cfg": {"name": "x", "tags": ["a", "b"]},
+    "items": [
+        {"n": "p", "subs": [{"k": 1}, {"k": 2}]},
+        {"n": "q", "subs": [{"k": 3}, {"k": 4}]}
+    ]
+}`
+
+// column returns the values of the named column of a table.
+func column(t *testing.T, db *model.Database, table, name string) []model.Value {
+	t.Helper()
+	tbl, ok := db.TableByName(table)
+	if !ok {
+		t.Fatalf("missing table %s", table)
+	}
+	i, ok := tbl.ColumnIndex(name)
+	if !ok {
+		t.Fatalf("table %s: missing column %s", table, name)
+	}
+	values := make([]model.Value, 0, len(tbl.Rows))
+	for _, row := range tbl.Rows {
+		values = append(values, row[i])
+	}
+	return values
+}
+
+func ints(values ...int64) []model.Value {
+	out := make([]model.Value, 0, len(values))
+	for _, v := range values {
+		out = append(out, model.IntValue(v))
+	}
+	return out
+}
+
+func TestImportGeneratesParentKeys(t *testing.T) {
+	db, err := Import(strings.NewReader(nestedJSON))
+	if err != nil {
+		t.Fatalf("import: %v", err)
+	}
+
+	for table, want := range map[string][]model.Value{"cfg": ints(1), "items": ints(1, 2)} {
+		tbl, _ := db.TableByName(table)
+		if !reflect.DeepEqual(tbl.PK, []string{"id"}) || tbl.Columns[0].Name != "id" || !tbl.Columns[0].Generated {
+			t.Errorf("table %s: expected a leading generated id primary key, got columns %v pk %v", table, tbl.Columns, tbl.PK)
+		}
+		if got := column(t, db, table, "id"); !reflect.DeepEqual(got, want) {
+			t.Errorf("table %s: id = %v, want %v", table, got, want)
+		}
+	}
+	// Every item of an array under a single object links to its one row
+	if got := column(t, db, "cfg_tags", "cfg_id"); !reflect.DeepEqual(got, ints(1, 1)) {
+		t.Errorf("cfg_tags.cfg_id = %v", got)
+	}
+	if got := column(t, db, "items_subs", "items_id"); !reflect.DeepEqual(got, ints(1, 1, 2, 2)) {
+		t.Errorf("items_subs.items_id = %v", got)
+	}
+
+	// Tables without children get no key
+	if subs, _ := db.TableByName("items_subs"); len(subs.PK) != 0 {
+		t.Errorf("unexpected key on items_subs: %v", subs.PK)
+	}
+	if issues := db.Validate(); len(issues) != 0 {
+		t.Errorf("unexpected validation issues: %v", issues)
+	}
+}
+
+func TestImportKeysParentsOnOwnID(t *testing.T) {
+	src := `{"items": [
+        {"id": 7, "subs": [{"k": 1}, {"k": 2}]},
+        {"id": 9, "subs": [{"k": 3}, {"k": 4}]}
+    ]}`
+	db, err := Import(strings.NewReader(src))
+	if err != nil {
+		t.Fatalf("import: %v", err)
+	}
+
+	items, _ := db.TableByName("items")
+	if len(items.Columns) != 1 || items.Columns[0].Generated || !reflect.DeepEqual(items.PK, []string{"id"}) {
+		t.Errorf("expected the JSON's id as the key, got columns %v pk %v", items.ColumnNames(), items.PK)
+	}
+	if got := column(t, db, "items_subs", "items_id"); !reflect.DeepEqual(got, ints(7, 7, 9, 9)) {
+		t.Errorf("items_subs.items_id = %v", got)
+	}
+}
+
+func TestImportKeysParentsBesideOwnID(t *testing.T) {
+	// Repeated ids can't be the key, nor can id_2, which holds text
+	src := `{"items": [
+        {"id": 7, "id_2": "a", "subs": [{"k": 1}, {"k": 2}]},
+        {"id": 7, "id_2": "b", "subs": [{"k": 3}, {"k": 4}]}
+    ]}`
+	db, err := Import(strings.NewReader(src))
+	if err != nil {
+		t.Fatalf("import: %v", err)
+	}
+
+	items, _ := db.TableByName("items")
+	if items.Columns[0].Name != "id_3" || !items.Columns[0].Generated || !reflect.DeepEqual(items.PK, []string{"id_3"}) {
+		t.Errorf("expected a generated id_3 key, got columns %v pk %v", items.ColumnNames(), items.PK)
+	}
+	subs, _ := db.TableByName("items_subs")
+	want := []model.ForeignKey{{Name: "items_id", ReferencedTable: "items", ReferencedColumn: "id_3"}}
+	if !reflect.DeepEqual(subs.ForeignKeys, want) {
+		t.Errorf("expected items_subs to reference the generated key, got %v", subs.ForeignKeys)
+	}
+	if got := column(t, db, "items_subs", "items_id"); !reflect.DeepEqual(got, ints(1, 1, 2, 2)) {
+		t.Errorf("items_subs.items_id = %v", got)
+	}
+	if errs := db.Validate(); len(errs) > 0 {
+		t.Errorf("expected a valid database, got %v", errs)
+	}
+}
+
+func TestExportOmitsGeneratedKeys(t *testing.T) {
+	for _, src := range []string{
+		nestedJSON,
+		`{"items": [{"id": 7, "subs": [{"k": 1}, {"k": 2}]}, {"id": 9, "subs": [{"k": 3}, {"k": 4}]}]}`,
+		// The JSON's own ids look just like generated ones, but are kept
+		`{"items": [{"id": 1, "subs": [{"k": 1}, {"k": 2}]}, {"id": 2, "subs": [{"k": 3}, {"k": 4}]}]}`,
+		// Repeated ids stay as data beside a generated key
+		`{"items": [{"id": 7, "subs": [{"k": 1}, {"k": 2}]}, {"id": 7, "subs": [{"k": 3}, {"k": 4}]}]}`,
+	} {
+		imported, err := Import(strings.NewReader(src))
+		if err != nil {
+			t.Fatalf("import: %v", err)
+		}
+
+		// Through a SQLON file, as json-to-sqlon and sqlon-to-json do
+		var file bytes.Buffer
+		if err := sqlon.Format(&file, imported); err != nil {
+			t.Fatalf("format: %v", err)
+		}
+		db, err := sqlon.Parse(&file)
+		if err != nil {
+			t.Fatalf("parse: %v", err)
+		}
+
+		var buf bytes.Buffer
+		if err := Export(&buf, db); err != nil {
+			t.Fatalf("export: %v", err)
+		}
+
+		var want, got interface{}
+		if err := json.Unmarshal([]byte(src), &want); err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+			t.Fatalf("invalid JSON: %v\n%s", err, buf.String())
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("roundtrip changed the document:\n%s", buf.String())
+		}
+	}
+}
+
+func TestImportDetectDatetime(t *testing.T) {
+	src := `{"events": [
+        {"at": "2024-05-01T10:00:00Z", "note": "2024-05-01T10:00:00Z"},
+        {"at": null, "note": "soon"},
+        {"at": "2024-05-02T11:30:00+02:00", "note": "later"}
+    ]}`
+	db, err := ImportWithOptions(strings.NewReader(src), ImportOptions{DetectDatetime: true})
+	if err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	events, _ := db.TableByName("events")
+
+	at, _ := events.ColumnIndex("at")
+	if got := events.Columns[at].Type; got != model.ColumnTypeDatetime {
+		t.Errorf("at: expected type datetime, got %s", got)
+	}
+	kinds := []model.ValueKind{model.ValueKindDatetime, model.ValueKindNull, model.ValueKindDatetime}
+	for i, want := range kinds {
+		if got := events.Rows[i][at].Kind; got != want {
+			t.Errorf("at row %d: expected %s, got %s", i+1, want, got)
+		}
+	}
+
+	// A timestamp followed by other strings keeps the whole column text
+	note, _ := events.ColumnIndex("note")
+	if got := events.Columns[note].Type; got != model.ColumnTypeText {
+		t.Errorf("note: expected type text, got %s", got)
+	}
+	for i, row := range events.Rows {
+		if row[note].Kind != model.ValueKindText {
+			t.Errorf("note row %d: expected text, got %s", i+1, row[note].Kind)
+		}
+	}
+
+	if issues := db.Validate(); len(issues) != 0 {
+		t.Errorf("unexpected validation issues: %v", issues)
+	}
+}
+
+func TestImportDetectDatetimeMixedAfterText(t *testing.T) {
+	src := `{"events": [{"note": "soon"}, {"note": "2024-05-01T10:00:00Z"}]}`
+	db, err := ImportWithOptions(strings.NewReader(src), ImportOptions{DetectDatetime: true})
+	if err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	events, _ := db.TableByName("events")
+	if got := events.Rows[1][0].Kind; got != model.ValueKindText {
+		t.Errorf("expected the timestamp kept as text, got %s", got)
+	}
+	if issues := db.Validate(); len(issues) != 0 {
+		t.Errorf("unexpected validation issues: %v", issues)
+	}
+}
+
+func TestImportSchemaDecodesBlobs(t *testing.T) {
+	schema := &model.Database{
+		Tables: []*model.Table{
+			{Name: "files", Columns: []model.Column{{Name: "data", Type: model.ColumnTypeBlob}}},
+		},
+	}
+
+	src := `{"files": [{"data": "AAEC/w==", "name": "a"}, {"data": null, "name": "b"}]}`
+	db, err := ImportWithOptions(strings.NewReader(src), ImportOptions{Schema: schema})
+	if err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	files, _ := db.TableByName("files")
+	i, _ := files.ColumnIndex("data")
+	if got := files.Columns[i].Type; got != model.ColumnTypeBlob {
+		t.Errorf("expected type blob, got %s", got)
+	}
+	if got := files.Rows[0][i]; got.Kind != model.ValueKindBlob || !bytes.Equal(got.Bytes, []byte{0, 1, 2, 255}) {
+		t.Errorf("expected decoded bytes, got %s %s", got.Kind, got)
+	}
+	if got := files.Rows[1][i].Kind; got != model.ValueKindNull {
+		t.Errorf("expected null kept, got %s", got)
+	}
+
+	_, err = ImportWithOptions(strings.NewReader(`{"files": [{"data": "not base64!"}]}`), ImportOptions{Schema: schema})
+	if err == nil || !strings.Contains(err.Error(), "base64") {
+		t.Errorf("expected a base64 error, got %v", err)
+	}
+}
+
+func TestImportIndexesForeignKeys(t *testing.T) {
+	db, err := Import(strings.NewReader(nestedJSON))
+	if err != nil {
+		t.Fatalf("import: %v", err)
+	}
+
+	want := map[string][]model.Index{
+		"cfg":        nil,
+		"cfg_tags":   {{Name: "idx_cfg_tags_cfg_id", Columns: []string{"cfg_id"}}},
+		"items":      nil,
+		"items_subs": {{Name: "idx_items_subs_items_id", Columns: []string{"items_id"}}},
+	}
+	for name, indexes := range want {
+		table, ok := db.TableByName(name)
+		if !ok {
+			t.Fatalf("missing table %s", name)
+		}
+		if !reflect.DeepEqual(table.Indexes, indexes) {
+			t.Errorf("table %s: indexes = %+v, want %+v", name, table.Indexes, indexes)
+		}
+	}
+}
+
+func TestImportSkipsIndexesOnRootLinks(t *testing.T) {
+	db, err := Import(strings.NewReader(`{"version": 2, "settings": {"a": 1}}`))
+	if err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	settings, ok := db.TableByName("settings")
+	if !ok {
+		t.Fatalf("missing settings table")
+	}
+	if len(settings.ForeignKeys) != 1 || settings.ForeignKeys[0].ReferencedTable != "" {
+		t.Fatalf("expected a link to the JSON root, got %+v", settings.ForeignKeys)
+	}
+	if len(settings.Indexes) != 0 {
+		t.Errorf("unexpected indexes on a root link: %+v", settings.Indexes)
+	}
+}
@@ -0,0 +1,174 @@
+package sql
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"sqlon/internal/diff"
+	"sqlon/internal/model"
+)
+
+// ExportChanges writes the INSERT, UPDATE and DELETE statements that turn
+// the rows of from into those of to, as matched by diff.Compare. The
+// database is expected to have to's schema already, e.g. after applying
+// ExportMigration, so rows of tables missing from to are left alone.
+//
+// Deletes run child-first, then updates, then inserts parent-first, all in
+// one transaction. SQLite defers its foreign key checks to the commit; the
+// other dialects check each statement, so there an update that moves a
+// child off a deleted parent fails.
+//
+// A table without a primary key has no way to address one of several
+// identical rows, so every copy of a deleted row is removed and the copies
+// to still holds are inserted again.
+//
+// Nothing is written when the rows match.
+func ExportChanges(w io.Writer, from, to *model.Database, opts ExportOptions) error {
+	if opts.Upsert {
+		return fmt.Errorf("upsert does not apply to change scripts")
+	}
+	d, err := newDialect(to, opts)
+	if err != nil {
+		return err
+	}
+
+	changes := diff.Compare(from, to)
+	if changes.Empty() {
+		return nil
+	}
+
+	begin := "BEGIN;\n"
+	if _, ok := d.(sqliteDialect); ok {
+		// Lasts until the transaction ends
+		begin += "PRAGMA defer_foreign_keys=ON;\n"
+	}
+	if _, err := io.WriteString(w, begin); err != nil {
+		return err
+	}
+
+	tables := to.TablesInDependencyOrder()
+	reinsert := make(map[string][]model.Row)
+
+	// Children first, so that no row is left referencing a deleted parent
+	for i := len(tables) - 1; i >= 0; i-- {
+		td, ok := changes.Table(tables[i].Name)
+		if !ok || td.Old == nil || len(td.Deleted) == 0 {
+			continue
+		}
+		if _, err := io.WriteString(w, "\n"); err != nil {
+			return err
+		}
+		if td.Keyed {
+			for _, row := range td.Deleted {
+				if _, err := fmt.Fprintf(w, "DELETE FROM %s WHERE %s;\n", d.tableName(td.Name), matchRow(d, td.Old, row, td.Key)); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		rows, err := deleteUnkeyed(w, d, td)
+		if err != nil {
+			return err
+		}
+		reinsert[td.Name] = rows
+	}
+
+	for _, t := range tables {
+		td, ok := changes.Table(t.Name)
+		if !ok || len(td.Updated) == 0 {
+			continue
+		}
+		if _, err := io.WriteString(w, "\n"); err != nil {
+			return err
+		}
+		for _, u := range td.Updated {
+			sets := make([]string, 0, len(u.Changed))
+			for _, name := range u.Changed {
+				i, _ := t.ColumnIndex(name)
+				sets = append(sets, d.quoteIdent(name)+" = "+d.literal(u.New.At(i)))
+			}
+			if _, err := fmt.Fprintf(w, "UPDATE %s SET %s WHERE %s;\n", d.tableName(t.Name), strings.Join(sets, ", "), matchRow(d, t, u.New, td.Key)); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Parents first, so that every new row's references exist
+	for _, t := range tables {
+		rows := reinsert[t.Name]
+		if td, ok := changes.Table(t.Name); ok {
+			rows = append(rows, td.Inserted...)
+		}
+		if len(rows) == 0 {
+			continue
+		}
+		if _, err := io.WriteString(w, "\n"); err != nil {
+			return err
+		}
+		inserted := *t
+		inserted.Rows = rows
+		if err := emitInserts(w, &inserted, d, opts); err != nil {
+			return err
+		}
+	}
+
+	_, err = io.WriteString(w, "\nCOMMIT;\n")
+	return err
+}
+
+// deleteUnkeyed deletes td's removed rows from a table without a primary
+// key. Each DELETE takes every identical copy, so it returns the copies of
+// those rows that the new table still holds, to be inserted again.
+func deleteUnkeyed(w io.Writer, d dialect, td *diff.TableDiff) ([]model.Row, error) {
+	oldKey := columnIndexes(td.Old, td.Key)
+	newKey := columnIndexes(td.New, td.Key)
+
+	deleted := make(map[string]bool)
+	for _, row := range td.Deleted {
+		k := model.RowKey(row, oldKey)
+		if deleted[k] {
+			continue
+		}
+		deleted[k] = true
+		if _, err := fmt.Fprintf(w, "DELETE FROM %s WHERE %s;\n", d.tableName(td.Name), matchRow(d, td.Old, row, td.Key)); err != nil {
+			return nil, err
+		}
+	}
+
+	var kept []model.Row
+	for _, row := range td.New.Rows {
+		if deleted[model.RowKey(row, newKey)] {
+			kept = append(kept, row)
+		}
+	}
+	return kept, nil
+}
+
+// matchRow renders a WHERE condition selecting row by the named columns.
+func matchRow(d dialect, t *model.Table, row model.Row, columns []string) string {
+	if len(columns) == 0 {
+		// Nothing to tell rows apart by
+		return "1 = 1"
+	}
+	conds := make([]string, 0, len(columns))
+	for _, name := range columns {
+		i, _ := t.ColumnIndex(name)
+		v := row.At(i)
+		if v.Kind == model.ValueKindNull {
+			conds = append(conds, d.quoteIdent(name)+" IS NULL")
+		} else {
+			conds = append(conds, d.quoteIdent(name)+" = "+d.literal(v))
+		}
+	}
+	return strings.Join(conds, " AND ")
+}
+
+func columnIndexes(t *model.Table, names []string) []int {
+	idx := make([]int, 0, len(names))
+	for _, name := range names {
+		i, _ := t.ColumnIndex(name)
+		idx = append(idx, i)
+	}
+	return idx
+}
@@ -0,0 +1,143 @@
+package sql
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"sqlon/internal/model"
+)
+
+func changesDatabase(people, posts, tags []model.Row) *model.Database {
+	return &model.Database{
+		Tables: []*model.Table{
+			{
+				Name:    "tags",
+				Columns: []model.Column{{Name: "post_id", Type: model.ColumnTypeInt}, {Name: "tag", Type: model.ColumnTypeText}},
+				ForeignKeys: []model.ForeignKey{
+					{Name: "post_id", ReferencedTable: "posts", ReferencedColumn: "id"},
+				},
+				Rows: tags,
+			},
+			{
+				Name: "posts",
+				Columns: []model.Column{
+					{Name: "id", Type: model.ColumnTypeInt},
+					{Name: "author_id", Type: model.ColumnTypeInt},
+					{Name: "title", Type: model.ColumnTypeText},
+				},
+				PK: []string{"id"},
+				ForeignKeys: []model.ForeignKey{
+					{Name: "author_id", ReferencedTable: "people", ReferencedColumn: "id"},
+				},
+				Rows: posts,
+			},
+			{
+				Name:    "people",
+				Columns: []model.Column{{Name: "id", Type: model.ColumnTypeInt}, {Name: "name", Type: model.ColumnTypeText}},
+				PK:      []string{"id"},
+				Rows:    people,
+			},
+		},
+	}
+}
+
+func TestExportChanges(t *testing.T) {
+	from := changesDatabase(
+		[]model.Row{{model.IntValue(1), model.TextValue("Ann")}, {model.IntValue(2), model.TextValue("Bob")}},
+		[]model.Row{
+			{model.IntValue(1), model.IntValue(1), model.TextValue("Draft")},
+			{model.IntValue(2), model.IntValue(2), model.TextValue("Bob's")},
+		},
+		[]model.Row{
+			{model.IntValue(1), model.TextValue("a")},
+			{model.IntValue(1), model.TextValue("b")},
+			{model.IntValue(1), model.TextValue("b")},
+			{model.IntValue(2), model.TextValue("x")},
+		},
+	)
+	to := changesDatabase(
+		[]model.Row{{model.IntValue(1), model.TextValue("Ann")}, {model.IntValue(3), model.TextValue("Cy")}},
+		[]model.Row{
+			{model.IntValue(1), model.IntValue(3), model.TextValue("it's final")},
+			{model.IntValue(4), model.IntValue(3), model.TextValue("New")},
+		},
+		[]model.Row{
+			{model.IntValue(1), model.TextValue("b")},
+			{model.IntValue(4), model.TextValue("n")},
+		},
+	)
+
+	var buf bytes.Buffer
+	if err := ExportChanges(&buf, from, to, ExportOptions{}); err != nil {
+		t.Fatalf("export: %v", err)
+	}
+
+	want := `BEGIN;
+PRAGMA defer_foreign_keys=ON;
+
+DELETE FROM "tags" WHERE "post_id" = 1 AND "tag" = 'a';
+DELETE FROM "tags" WHERE "post_id" = 1 AND "tag" = 'b';
+DELETE FROM "tags" WHERE "post_id" = 2 AND "tag" = 'x';
+
+DELETE FROM "posts" WHERE "id" = 2;
+
+DELETE FROM "people" WHERE "id" = 2;
+
+UPDATE "posts" SET "author_id" = 3, "title" = 'it''s final' WHERE "id" = 1;
+
+INSERT INTO "people" ("id", "name") VALUES (3, 'Cy');
+
+INSERT INTO "posts" ("id", "author_id", "title") VALUES (4, 3, 'New');
+
+INSERT INTO "tags" ("post_id", "tag") VALUES (1, 'b');
+INSERT INTO "tags" ("post_id", "tag") VALUES (4, 'n');
+
+COMMIT;
+`
+	if buf.String() != want {
+		t.Errorf("unexpected change script:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
+
+func TestExportChangesNothingChanged(t *testing.T) {
+	rows := []model.Row{{model.IntValue(1), model.TextValue("Ann")}}
+	var buf bytes.Buffer
+	if err := ExportChanges(&buf, changesDatabase(rows, nil, nil), changesDatabase(rows, nil, nil), ExportOptions{}); err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("expected no output, got:\n%s", buf.String())
+	}
+}
+
+func TestExportChangesPostgres(t *testing.T) {
+	from := changesDatabase([]model.Row{{model.IntValue(1), model.NullValue()}}, nil, nil)
+	to := changesDatabase([]model.Row{{model.IntValue(2), model.TextValue("Cy")}}, nil, nil)
+
+	var buf bytes.Buffer
+	if err := ExportChanges(&buf, from, to, ExportOptions{Dialect: DialectPostgres}); err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		`DELETE FROM "public"."people" WHERE "id" = 1;`,
+		`INSERT INTO "public"."people" ("id", "name") VALUES (2, E'Cy');`,
+		`SELECT setval(`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected output to contain %s, got:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "PRAGMA") {
+		t.Errorf("unexpected SQLite pragma in Postgres output:\n%s", out)
+	}
+}
+
+func TestMatchRowNull(t *testing.T) {
+	table := &model.Table{Columns: []model.Column{{Name: "a", Type: model.ColumnTypeInt}, {Name: "b", Type: model.ColumnTypeText}}}
+	got := matchRow(sqliteDialect{}, table, model.Row{model.IntValue(1), model.NullValue()}, []string{"a", "b"})
+	if want := `"a" = 1 AND "b" IS NULL`; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,162 @@
+package sql
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"sqlon/internal/model"
+)
+
+// Dialect names a SQL flavour that Export can produce.
+type Dialect string
+
+const (
+	DialectSQLite   Dialect = "sqlite"
+	DialectPostgres Dialect = "postgres"
+	DialectMySQL    Dialect = "mysql" // also MariaDB
+)
+
+// dialect captures everything that differs between SQL flavours: identifier
+// quoting, type mapping and literal syntax. The statement layout itself is
+// shared and lives in export.go.
+type dialect interface {
+	// preamble is written once, before the first table.
+	preamble(w io.Writer, db *model.Database) error
+
+	quoteIdent(name string) string
+
+	// tableName returns the quoted, possibly qualified, name of a table.
+	tableName(name string) string
+
+	// columnType returns the SQL type of c, without constraints.
+	columnType(t *model.Table, c model.Column) string
+
+	// enumConstraint returns the constraint appended to an enum column, if
+	// the dialect has no native enum type.
+	enumConstraint(c model.Column, e *model.Enum) string
+
+	literal(v model.Value) string
+
+	// tableOptions is appended after a CREATE TABLE's closing parenthesis.
+	tableOptions() string
+
+	// afterInserts is written after a table's rows.
+	afterInserts(w io.Writer, t *model.Table) error
+}
+
+func newDialect(db *model.Database, opts ExportOptions) (dialect, error) {
+	switch opts.Dialect {
+	case "", DialectSQLite:
+		return sqliteDialect{datetime: opts.Datetime}, nil
+	case DialectPostgres:
+		schema := opts.Schema
+		if schema == "" {
+			schema = "public"
+		}
+		return postgresDialect{schema: schema, upsert: opts.Upsert}, nil
+	case DialectMySQL:
+		return mysqlDialect{db: db, schema: opts.Schema}, nil
+	default:
+		return nil, fmt.Errorf("unknown SQL dialect %q", opts.Dialect)
+	}
+}
+
+type sqliteDialect struct {
+	datetime DatetimeStorage
+}
+
+func (d sqliteDialect) preamble(w io.Writer, db *model.Database) error {
+	// SQLite ignores FOREIGN KEY clauses unless this is switched on
+	_, err := io.WriteString(w, "PRAGMA foreign_keys=ON;\n\n")
+	return err
+}
+
+func (d sqliteDialect) quoteIdent(name string) string {
+	return quoteIdent(name)
+}
+
+func (d sqliteDialect) tableName(name string) string {
+	return quoteIdent(name)
+}
+
+func (d sqliteDialect) columnType(t *model.Table, c model.Column) string {
+	switch c.Type {
+	case model.ColumnTypeInt:
+		return "INTEGER"
+	case model.ColumnTypeText:
+		return "TEXT"
+	case model.ColumnTypeBool:
+		// SQLite accepts any type name; these keep the SQLON type for import
+		// while storing 0/1 and ISO text (or Unix seconds) as before
+		return "BOOLEAN"
+	case model.ColumnTypeDecimal:
+		// The name gives the column TEXT affinity, so SQLite stores the
+		// quoted literal as written instead of rounding it to a double
+		return "DECIMAL_TEXT"
+	case model.ColumnTypeDatetime:
+		return "DATETIME"
+	case model.ColumnTypeNull:
+		return "TEXT"
+	case model.ColumnTypeBlob:
+		return "BLOB"
+	default:
+		return "TEXT"
+	}
+}
+
+// enumConstraint renders an enum column as a named CHECK constraint. The
+// constraint carries the enum's name so that ParseSQLite can recover it.
+func (d sqliteDialect) enumConstraint(c model.Column, e *model.Enum) string {
+	values := make([]string, 0, len(e.Values))
+	for _, v := range e.Values {
+		values = append(values, d.literal(model.TextValue(v)))
+	}
+	return fmt.Sprintf(" CONSTRAINT %s CHECK (%s IN (%s))", quoteIdent(e.Name), quoteIdent(c.Name), strings.Join(values, ", "))
+}
+
+func (d sqliteDialect) literal(v model.Value) string {
+	switch v.Kind {
+	case model.ValueKindNull:
+		return "NULL"
+	case model.ValueKindInt:
+		return fmt.Sprintf("%d", v.Int64)
+	case model.ValueKindDecimal:
+		return "'" + v.Decimal.String() + "'"
+	case model.ValueKindBool:
+		if v.Bool {
+			return "1"
+		}
+		return "0"
+	case model.ValueKindText:
+		return "'" + escapeSQLString(v.Text) + "'"
+	case model.ValueKindDatetime:
+		if d.datetime == DatetimeEpoch {
+			return fmt.Sprintf("%d", v.Time.Unix())
+		}
+		return "'" + model.FormatDatetime(v.Time) + "'"
+	case model.ValueKindBlob:
+		return fmt.Sprintf("X'%X'", v.Bytes)
+	default:
+		return "NULL"
+	}
+}
+
+func (d sqliteDialect) tableOptions() string {
+	return ""
+}
+
+func (d sqliteDialect) afterInserts(w io.Writer, t *model.Table) error {
+	return nil
+}
+
+// quoteIdent quotes an identifier the standard SQL way, which SQLite and
+// Postgres share. MySQL uses backticks instead.
+func quoteIdent(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+}
+
+// escapeSQLString escapes s for a standard single-quoted SQL string.
+func escapeSQLString(s string) string {
+	return strings.ReplaceAll(s, `'`, `''`)
+}
@@ -8,139 +8,323 @@ import (
 	"sqlon/internal/model"
 )
 
-func ExportSQLite(w io.Writer, db *model.Database) error {
-	for ti, t := range db.Tables {
-		if err := emitCreateTable(w, t); err != nil {
+// DatetimeStorage selects how datetime values are stored, since SQLite has
+// no native datetime type.
+type DatetimeStorage int
+
+const (
+	DatetimeISO   DatetimeStorage = iota // text holding canonical RFC 3339
+	DatetimeEpoch                        // integer Unix seconds
+)
+
+type ExportOptions struct {
+	// Dialect selects the SQL flavour; the zero value is SQLite.
+	Dialect Dialect
+
+	// Datetime selects how SQLite stores datetime values. Other dialects
+	// have a native timestamp type and ignore it.
+	Datetime DatetimeStorage
+
+	// OnDeleteCascade adds ON DELETE CASCADE to every foreign key, so that
+	// deleting a parent row removes its children.
+	OnDeleteCascade bool
+
+	// BatchSize, when above one, groups up to that many rows into each
+	// INSERT and wraps the script in a single transaction, which loads
+	// large exports far faster than one autocommitted statement per row.
+	BatchSize int
+
+	// Upsert makes the script safe to apply again to a database it has
+	// already loaded: tables and indexes are only created if missing, and
+	// rows replace those with the same primary key. Tables without a
+	// primary key are emptied and refilled. Rows removed from the SQLON
+	// are not deleted from keyed tables.
+	Upsert bool
+
+	// Schema qualifies every table name in dialects with schemas. Postgres
+	// uses "public" when it is empty; MySQL leaves names unqualified.
+	Schema string
+}
+
+// Export writes db as a SQL script in the dialect chosen by opts.
+func Export(w io.Writer, db *model.Database, opts ExportOptions) error {
+	if opts.Upsert && opts.Dialect == DialectMySQL {
+		return fmt.Errorf("upsert export is not supported for %s", opts.Dialect)
+	}
+	d, err := newDialect(db, opts)
+	if err != nil {
+		return err
+	}
+
+	if err := d.preamble(w, db); err != nil {
+		return err
+	}
+
+	batched := opts.BatchSize > 1
+	if batched {
+		if _, err := io.WriteString(w, "BEGIN;\n\n"); err != nil {
+			return err
+		}
+	}
+
+	// Parents are created (and filled) before the children referencing them
+	tables := db.TablesInDependencyOrder()
+	for ti, t := range tables {
+		if err := emitCreateTable(w, db, t, d, opts); err != nil {
 			return err
 		}
 
+		if opts.Upsert && len(t.PK) == 0 {
+			// Without a key there is nothing to match rows on
+			if _, err := fmt.Fprintf(w, "DELETE FROM %s;\n", d.tableName(t.Name)); err != nil {
+				return err
+			}
+		}
+
 		if len(t.Rows) > 0 {
-			if err := emitInserts(w, t); err != nil {
+			if err := emitInserts(w, t, d, opts); err != nil {
 				return err
 			}
 		}
 
-		if ti < len(db.Tables)-1 {
+		// Indexes are created after the rows are loaded, which is faster
+		// than maintaining them insert by insert
+		if err := emitIndexes(w, t, d, opts); err != nil {
+			return err
+		}
+
+		if ti < len(tables)-1 {
 			if _, err := io.WriteString(w, "\n"); err != nil {
 				return err
 			}
 		}
 	}
 
+	if batched {
+		if _, err := io.WriteString(w, "\nCOMMIT;\n"); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
-func emitCreateTable(w io.Writer, t *model.Table) error {
-	if _, err := fmt.Fprintf(w, "CREATE TABLE %s (\n", quoteIdent(t.Name)); err != nil {
+func ExportSQLite(w io.Writer, db *model.Database) error {
+	return ExportSQLiteWithOptions(w, db, ExportOptions{})
+}
+
+func ExportSQLiteWithOptions(w io.Writer, db *model.Database, opts ExportOptions) error {
+	opts.Dialect = DialectSQLite
+	return Export(w, db, opts)
+}
+
+func emitCreateTable(w io.Writer, db *model.Database, t *model.Table, d dialect, opts ExportOptions) error {
+	stmt, err := createTableSQL(db, t, t.Name, d, opts)
+	if err != nil {
 		return err
 	}
+	_, err = io.WriteString(w, stmt)
+	return err
+}
 
-	for i, c := range t.Columns {
-		colLine := "    " + quoteIdent(c.Name) + " " + sqliteType(c.Type)
-		if t.PK != "" && c.Name == t.PK {
-			colLine += " PRIMARY KEY"
-		}
+// createTableSQL renders the CREATE TABLE statement for t, under the given
+// table name.
+func createTableSQL(db *model.Database, t *model.Table, name string, d dialect, opts ExportOptions) (string, error) {
+	create := "CREATE TABLE"
+	if opts.Upsert {
+		create += " IF NOT EXISTS"
+	}
 
-		if i < len(t.Columns)-1 {
-			colLine += ","
+	lines := make([]string, 0, len(t.Columns)+1)
+	for _, c := range t.Columns {
+		def, err := columnDefinition(db, t, c, d)
+		if err != nil {
+			return "", err
 		}
-		colLine += "\n"
+		lines = append(lines, "    "+def)
+	}
+	for _, constraint := range tableConstraints(db, t, d, opts) {
+		lines = append(lines, "    "+constraint)
+	}
 
-		if _, err := io.WriteString(w, colLine); err != nil {
-			return err
+	return fmt.Sprintf("%s %s (\n%s\n)%s;\n", create, d.tableName(name), strings.Join(lines, ",\n"), d.tableOptions()), nil
+}
+
+// columnDefinition renders c as it is declared inside CREATE TABLE. A
+// single-column key is declared inline; composite keys need a table-level
+// constraint.
+func columnDefinition(db *model.Database, t *model.Table, c model.Column, d dialect) (string, error) {
+	def := d.quoteIdent(c.Name) + " " + d.columnType(t, c)
+	if len(t.PK) == 1 && c.Name == t.PK[0] {
+		if _, ok := d.(sqliteDialect); ok && c.Generated {
+			// The name lets ParseSQLite mark the key generated again
+			def += " CONSTRAINT " + d.quoteIdent("generated")
 		}
+		def += " PRIMARY KEY"
+	}
+	def += columnConstraints(c, d)
+	if c.Type == model.ColumnTypeNull {
+		// A null column holds nothing else, which the check records
+		def += " CHECK (" + d.quoteIdent(c.Name) + " IS NULL)"
 	}
+	if c.Type == model.ColumnTypeEnum {
+		e, ok := db.EnumByName(c.Enum)
+		if !ok {
+			return "", fmt.Errorf("table %q column %q uses undeclared enum %q", t.Name, c.Name, c.Enum)
+		}
+		def += d.enumConstraint(c, e)
+	}
+	return def, nil
+}
 
-	if _, err := io.WriteString(w, ");\n"); err != nil {
-		return err
+// tableConstraints renders t's composite primary key and its foreign keys.
+func tableConstraints(db *model.Database, t *model.Table, d dialect, opts ExportOptions) []string {
+	var constraints []string
+	if len(t.PK) > 1 {
+		constraints = append(constraints, "PRIMARY KEY ("+quoteIdentList(d, t.PK)+")")
 	}
+	for _, fk := range t.ForeignKeys {
+		if !enforceableFK(db, fk) {
+			continue
+		}
+		constraint := fmt.Sprintf("FOREIGN KEY (%s) REFERENCES %s (%s)",
+			d.quoteIdent(fk.Name), d.tableName(fk.ReferencedTable), d.quoteIdent(fk.ReferencedColumn))
+		if opts.OnDeleteCascade {
+			constraint += " ON DELETE CASCADE"
+		}
+		constraints = append(constraints, constraint)
+	}
+	return constraints
+}
 
-	return nil
+// enforceableFK reports whether SQLite can enforce fk. SQLite requires the
+// parent key to be the parent's primary key or a unique column; otherwise
+// every write to the child table fails with "foreign key mismatch", so such
+// keys (e.g. those inferred against a parent without an id column) are left
+// out of the DDL rather than making the whole export unloadable.
+func enforceableFK(db *model.Database, fk model.ForeignKey) bool {
+	parent, ok := db.TableByName(fk.ReferencedTable)
+	if !ok {
+		return false
+	}
+	i, ok := parent.ColumnIndex(fk.ReferencedColumn)
+	if !ok {
+		return false
+	}
+	if len(parent.PK) == 1 && parent.PK[0] == fk.ReferencedColumn {
+		return true
+	}
+	if parent.Columns[i].Unique {
+		return true
+	}
+	for _, idx := range parent.Indexes {
+		if idx.Unique && len(idx.Columns) == 1 && idx.Columns[0] == fk.ReferencedColumn {
+			return true
+		}
+	}
+	return false
 }
 
-func emitInserts(w io.Writer, t *model.Table) error {
-	colNames := t.ColumnNames()
-	quotedCols := make([]string, 0, len(colNames))
-	for _, n := range colNames {
-		quotedCols = append(quotedCols, quoteIdent(n))
+func columnConstraints(c model.Column, d dialect) string {
+	s := ""
+	if c.NotNull {
+		s += " NOT NULL"
 	}
+	if c.Unique {
+		s += " UNIQUE"
+	}
+	if c.Default != nil {
+		s += " DEFAULT " + d.literal(*c.Default)
+	}
+	return s
+}
 
+// emitInserts writes t's rows, opts.BatchSize to a statement. A batch size
+// of one or less writes a statement per row.
+func emitInserts(w io.Writer, t *model.Table, d dialect, opts ExportOptions) error {
+	colNames := t.ColumnNames()
 	prefix := fmt.Sprintf(
-		"INSERT INTO %s (%s) VALUES ",
-		quoteIdent(t.Name),
-		strings.Join(quotedCols, ", "),
+		"INSERT INTO %s (%s) VALUES",
+		d.tableName(t.Name),
+		quoteIdentList(d, colNames),
 	)
+	suffix := ""
+	if opts.Upsert && len(t.PK) > 0 {
+		suffix = upsertClause(t, d)
+	}
+	batchSize := max(opts.BatchSize, 1)
 
-	for _, row := range t.Rows {
-		if _, err := io.WriteString(w, prefix); err != nil {
-			return err
-		}
+	for start := 0; start < len(t.Rows); start += batchSize {
+		batch := t.Rows[start:min(start+batchSize, len(t.Rows))]
 
-		values := make([]string, 0, len(colNames))
-		for i := 0; i < len(colNames); i++ {
-			if i < len(row) {
-				values = append(values, sqliteLiteral(row[i]))
-			} else {
-				values = append(values, "NULL")
+		tuples := make([]string, 0, len(batch))
+		for _, row := range batch {
+			values := make([]string, 0, len(colNames))
+			for i := 0; i < len(colNames); i++ {
+				if i < len(row) {
+					values = append(values, d.literal(row[i]))
+				} else {
+					values = append(values, "NULL")
+				}
 			}
+			tuples = append(tuples, "("+strings.Join(values, ", ")+")")
 		}
 
-		if _, err := fmt.Fprintf(w, "(%s);\n", strings.Join(values, ", ")); err != nil {
+		var stmt string
+		if batchSize == 1 {
+			stmt = prefix + " " + tuples[0] + suffix + ";\n"
+		} else {
+			stmt = prefix + "\n    " + strings.Join(tuples, ",\n    ") + suffix + ";\n"
+		}
+		if _, err := io.WriteString(w, stmt); err != nil {
 			return err
 		}
 	}
 
-	return nil
+	return d.afterInserts(w, t)
 }
 
-func sqliteType(t model.ColumnType) string {
-	switch t {
-	case model.ColumnTypeInt:
-		return "INTEGER"
-	case model.ColumnTypeText:
-		return "TEXT"
-	case model.ColumnTypeBool:
-		return "INTEGER"
-	case model.ColumnTypeDecimal:
-		return "REAL"
-	case model.ColumnTypeDatetime:
-		return "TEXT"
-	case model.ColumnTypeNull:
-		return "TEXT"
-	default:
-		return "TEXT"
+// upsertClause returns the ON CONFLICT clause that makes an INSERT into t
+// overwrite the row with the same primary key.
+func upsertClause(t *model.Table, d dialect) string {
+	var sets []string
+	for _, c := range t.Columns {
+		if !t.IsPK(c.Name) {
+			sets = append(sets, d.quoteIdent(c.Name)+" = excluded."+d.quoteIdent(c.Name))
+		}
 	}
-}
-
-func sqliteLiteral(v model.Value) string {
-	switch v.Kind {
-	case model.ValueKindNull:
-		return "NULL"
-	case model.ValueKindInt:
-		return fmt.Sprintf("%d", v.Int64)
-	case model.ValueKindDecimal:
-		return trimFloat(v.Float64)
-	case model.ValueKindBool:
-		if v.Bool {
-			return "1"
-		}
-		return "0"
-	case model.ValueKindText:
-		return "'" + escapeSQLString(v.Text) + "'"
-	default:
-		return "NULL"
+	clause := " ON CONFLICT (" + quoteIdentList(d, t.PK) + ") DO "
+	if len(sets) == 0 {
+		return clause + "NOTHING"
 	}
+	return clause + "UPDATE SET " + strings.Join(sets, ", ")
 }
 
-func quoteIdent(s string) string {
-	return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+func emitIndexes(w io.Writer, t *model.Table, d dialect, opts ExportOptions) error {
+	for _, idx := range t.Indexes {
+		if _, err := io.WriteString(w, createIndexSQL(t, idx, d, opts)); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-func escapeSQLString(s string) string {
-	return strings.ReplaceAll(s, `'`, `''`)
+func createIndexSQL(t *model.Table, idx model.Index, d dialect, opts ExportOptions) string {
+	create := "CREATE "
+	if idx.Unique {
+		create += "UNIQUE "
+	}
+	create += "INDEX"
+	if opts.Upsert {
+		create += " IF NOT EXISTS"
+	}
+	return fmt.Sprintf("%s %s ON %s (%s);\n", create, d.quoteIdent(idx.Name), d.tableName(t.Name), quoteIdentList(d, idx.Columns))
 }
 
-func trimFloat(f float64) string {
-	s := fmt.Sprintf("%.15g", f)
-	return s
+func quoteIdentList(d dialect, names []string) string {
+	quoted := make([]string, 0, len(names))
+	for _, n := range names {
+		quoted = append(quoted, d.quoteIdent(n))
+	}
+	return strings.Join(quoted, ", ")
 }
@@ -0,0 +1,260 @@
+package sql
+
+import (
+	"fmt"
+	"strings"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF    tokenKind = iota
+	tokenWord             // bare identifier or keyword
+	tokenIdent            // quoted identifier: "x", `x` or [x]
+	tokenString           // 'x'
+	tokenBlob             // X'0A1B'
+	tokenNumber           // 42, 1.5, 1e+06 (unsigned; signs are punctuation)
+	tokenPunct            // ( ) , ; . and operators
+)
+
+// position is a 1-based line and column in the input, counted in bytes.
+type position struct {
+	line, col int
+}
+
+func (p position) String() string {
+	return fmt.Sprintf("line %d:%d", p.line, p.col)
+}
+
+type token struct {
+	kind tokenKind
+	text string // unescaped for identifiers and strings, hex for blobs
+	pos  position
+}
+
+// is reports whether t is the bare keyword or punctuation s, ignoring case.
+func (t token) is(s string) bool {
+	return (t.kind == tokenWord || t.kind == tokenPunct) && strings.EqualFold(t.text, s)
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokenEOF:
+		return "end of input"
+	case tokenString:
+		return "string '" + t.text + "'"
+	case tokenIdent:
+		return "identifier " + quoteIdent(t.text)
+	case tokenBlob:
+		return "blob X'" + t.text + "'"
+	default:
+		return fmt.Sprintf("%q", t.text)
+	}
+}
+
+// errorAt formats an error tagged with a position in the input.
+func errorAt(pos position, format string, args ...interface{}) error {
+	return fmt.Errorf("%s: %s", pos, fmt.Sprintf(format, args...))
+}
+
+// lexer splits SQL text into tokens, dropping whitespace and comments.
+type lexer struct {
+	src  string
+	off  int
+	line int
+	col  int
+}
+
+func lex(src string) ([]token, error) {
+	l := &lexer{src: src, line: 1, col: 1}
+	var toks []token
+	for {
+		tok, err := l.next()
+		if err != nil {
+			return nil, err
+		}
+		toks = append(toks, tok)
+		if tok.kind == tokenEOF {
+			return toks, nil
+		}
+	}
+}
+
+func (l *lexer) peek(n int) byte {
+	if l.off+n < len(l.src) {
+		return l.src[l.off+n]
+	}
+	return 0
+}
+
+func (l *lexer) advance() byte {
+	ch := l.src[l.off]
+	l.off++
+	if ch == '\n' {
+		l.line++
+		l.col = 1
+	} else {
+		l.col++
+	}
+	return ch
+}
+
+func (l *lexer) pos() position {
+	return position{line: l.line, col: l.col}
+}
+
+func (l *lexer) next() (token, error) {
+	if err := l.skipSpaceAndComments(); err != nil {
+		return token{}, err
+	}
+
+	start := l.pos()
+	if l.off >= len(l.src) {
+		return token{kind: tokenEOF, pos: start}, nil
+	}
+
+	ch := l.peek(0)
+	switch {
+	case (ch == 'x' || ch == 'X') && l.peek(1) == '\'':
+		l.advance()
+		hex, err := l.quoted('\'', '\'', start)
+		if err != nil {
+			return token{}, err
+		}
+		return token{kind: tokenBlob, text: hex, pos: start}, nil
+	case isIdentStart(ch):
+		begin := l.off
+		for l.off < len(l.src) && isIdentPart(l.peek(0)) {
+			l.advance()
+		}
+		return token{kind: tokenWord, text: l.src[begin:l.off], pos: start}, nil
+	case isDigit(ch) || (ch == '.' && isDigit(l.peek(1))):
+		return l.number(start), nil
+	case ch == '\'':
+		s, err := l.quoted('\'', '\'', start)
+		if err != nil {
+			return token{}, err
+		}
+		return token{kind: tokenString, text: s, pos: start}, nil
+	case ch == '"':
+		s, err := l.quoted('"', '"', start)
+		if err != nil {
+			return token{}, err
+		}
+		return token{kind: tokenIdent, text: s, pos: start}, nil
+	case ch == '`':
+		s, err := l.quoted('`', '`', start)
+		if err != nil {
+			return token{}, err
+		}
+		return token{kind: tokenIdent, text: s, pos: start}, nil
+	case ch == '[':
+		s, err := l.quoted('[', ']', start)
+		if err != nil {
+			return token{}, err
+		}
+		return token{kind: tokenIdent, text: s, pos: start}, nil
+	}
+
+	// Two-character operators, then any other single character
+	for _, op := range []string{"<=", ">=", "<>", "!=", "==", "||", "<<", ">>", "->"} {
+		if strings.HasPrefix(l.src[l.off:], op) {
+			l.advance()
+			l.advance()
+			return token{kind: tokenPunct, text: op, pos: start}, nil
+		}
+	}
+	l.advance()
+	return token{kind: tokenPunct, text: string(ch), pos: start}, nil
+}
+
+func (l *lexer) skipSpaceAndComments() error {
+	for l.off < len(l.src) {
+		ch := l.peek(0)
+		switch {
+		case ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r' || ch == '\f' || ch == '\v':
+			l.advance()
+		case ch == '-' && l.peek(1) == '-':
+			for l.off < len(l.src) && l.peek(0) != '\n' {
+				l.advance()
+			}
+		case ch == '/' && l.peek(1) == '*':
+			start := l.pos()
+			l.advance()
+			l.advance()
+			for {
+				if l.off >= len(l.src) {
+					return errorAt(start, "unterminated /* comment")
+				}
+				if l.peek(0) == '*' && l.peek(1) == '/' {
+					l.advance()
+					l.advance()
+					break
+				}
+				l.advance()
+			}
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+// quoted reads a string opened by open and closed by close. A doubled close
+// character stands for a single one, so that a quote can appear inside.
+func (l *lexer) quoted(open, close byte, start position) (string, error) {
+	l.advance() // opening quote
+	var b strings.Builder
+	for {
+		if l.off >= len(l.src) {
+			return "", errorAt(start, "unterminated %c%c quoted text", open, close)
+		}
+		ch := l.advance()
+		if ch == close {
+			if open == close && l.peek(0) == close {
+				b.WriteByte(l.advance())
+				continue
+			}
+			return b.String(), nil
+		}
+		b.WriteByte(ch)
+	}
+}
+
+func (l *lexer) number(start position) token {
+	begin := l.off
+	for isDigit(l.peek(0)) {
+		l.advance()
+	}
+	if l.peek(0) == '.' {
+		l.advance()
+		for isDigit(l.peek(0)) {
+			l.advance()
+		}
+	}
+	if e := l.peek(0); e == 'e' || e == 'E' {
+		sign := l.peek(1) == '+' || l.peek(1) == '-'
+		if isDigit(l.peek(1)) || (sign && isDigit(l.peek(2))) {
+			l.advance()
+			if sign {
+				l.advance()
+			}
+			for isDigit(l.peek(0)) {
+				l.advance()
+			}
+		}
+	}
+	return token{kind: tokenNumber, text: l.src[begin:l.off], pos: start}
+}
+
+func isDigit(ch byte) bool {
+	return ch >= '0' && ch <= '9'
+}
+
+func isIdentStart(ch byte) bool {
+	return ch == '_' || (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z') || ch >= 0x80
+}
+
+func isIdentPart(ch byte) bool {
+	return isIdentStart(ch) || isDigit(ch) || ch == '$'
+}
@@ -0,0 +1,267 @@
+package sql
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"sqlon/internal/model"
+)
+
+// ExportMigration writes the DDL that turns the schema of from into that of
+// to. Rows are not compared; existing rows are carried over into changed
+// tables. Only SQLite is supported.
+//
+// New columns appended to a table are added with ALTER TABLE where SQLite
+// allows it. Any other change to a table (a dropped, reordered or retyped
+// column, a new key or constraint) rebuilds it: a new table is created, the
+// shared columns are copied across, and it replaces the old one. A renamed
+// column looks like a dropped column plus a new one, so its values are lost.
+//
+// Nothing is written when the schemas match.
+func ExportMigration(w io.Writer, from, to *model.Database, opts ExportOptions) error {
+	if opts.Dialect != "" && opts.Dialect != DialectSQLite {
+		return fmt.Errorf("migrations are not supported for %s", opts.Dialect)
+	}
+	// The script must apply to the old schema exactly, not be idempotent
+	opts.Upsert = false
+	d := sqliteDialect{datetime: opts.Datetime}
+
+	m := migration{from: from, to: to, d: d, opts: opts}
+	stmts, err := m.statements()
+	if err != nil {
+		return err
+	}
+	if len(stmts) == 0 {
+		return nil
+	}
+
+	// Foreign keys are checked once at the end instead of during the
+	// rebuild, which briefly drops referenced tables. The pragma has no
+	// effect inside a transaction, so it brackets it.
+	var b strings.Builder
+	b.WriteString("PRAGMA foreign_keys=OFF;\nBEGIN;\n\n")
+	for _, stmt := range stmts {
+		b.WriteString(stmt)
+	}
+	b.WriteString("PRAGMA foreign_key_check;\nCOMMIT;\nPRAGMA foreign_keys=ON;\n")
+	_, err = io.WriteString(w, b.String())
+	return err
+}
+
+type migration struct {
+	from, to *model.Database
+	d        dialect
+	opts     ExportOptions
+}
+
+// tableChange is how a table present in both schemas is migrated.
+type tableChange int
+
+const (
+	tableUnchanged tableChange = iota
+	tableAddColumns
+	tableRebuild
+)
+
+func (m migration) statements() ([]string, error) {
+	changes := make(map[string]tableChange)
+	for _, t := range m.to.Tables {
+		old, ok := m.from.TableByName(t.Name)
+		if !ok {
+			continue
+		}
+		change, err := m.compare(old, t)
+		if err != nil {
+			return nil, err
+		}
+		changes[t.Name] = change
+	}
+
+	var stmts []string
+
+	// Index names are shared by all tables, so stale indexes go first in
+	// case a new one reuses the name. A dropped table takes its indexes
+	// with it.
+	oldIndexes := m.indexes(m.from)
+	newIndexes := m.indexes(m.to)
+	for _, t := range m.from.Tables {
+		if _, kept := m.to.TableByName(t.Name); !kept {
+			continue
+		}
+		for _, idx := range t.Indexes {
+			if newIndexes[idx.Name] != oldIndexes[idx.Name] {
+				stmts = append(stmts, fmt.Sprintf("DROP INDEX %s;\n", m.d.quoteIdent(idx.Name)))
+			}
+		}
+	}
+
+	if len(stmts) > 0 {
+		stmts = append(stmts, "\n")
+	}
+
+	// Dropped tables go child-first
+	dropped := len(stmts)
+	oldOrder := m.from.TablesInDependencyOrder()
+	for i := len(oldOrder) - 1; i >= 0; i-- {
+		t := oldOrder[i]
+		if _, kept := m.to.TableByName(t.Name); !kept {
+			stmts = append(stmts, fmt.Sprintf("DROP TABLE %s;\n", m.d.tableName(t.Name)))
+		}
+	}
+	if len(stmts) > dropped {
+		stmts = append(stmts, "\n")
+	}
+
+	// New and changed tables go parent-first
+	for _, t := range m.to.TablesInDependencyOrder() {
+		before := len(stmts)
+		old, existed := m.from.TableByName(t.Name)
+		change := changes[t.Name]
+		switch {
+		case !existed:
+			stmt, err := createTableSQL(m.to, t, t.Name, m.d, m.opts)
+			if err != nil {
+				return nil, err
+			}
+			stmts = append(stmts, stmt)
+		case change == tableAddColumns:
+			for _, c := range t.Columns[len(old.Columns):] {
+				def, err := columnDefinition(m.to, t, c, m.d)
+				if err != nil {
+					return nil, err
+				}
+				stmts = append(stmts, fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s;\n", m.d.tableName(t.Name), def))
+			}
+		case change == tableRebuild:
+			rebuild, err := m.rebuild(old, t)
+			if err != nil {
+				return nil, err
+			}
+			stmts = append(stmts, rebuild...)
+		}
+
+		// A new or rebuilt table needs all of its indexes
+		for _, idx := range t.Indexes {
+			if !existed || change == tableRebuild || newIndexes[idx.Name] != oldIndexes[idx.Name] {
+				stmts = append(stmts, createIndexSQL(t, idx, m.d, m.opts))
+			}
+		}
+		if len(stmts) > before {
+			stmts = append(stmts, "\n")
+		}
+	}
+
+	return stmts, nil
+}
+
+// compare decides how old must change to become t.
+func (m migration) compare(old, t *model.Table) (tableChange, error) {
+	oldCreate, err := createTableSQL(m.from, old, old.Name, m.d, m.opts)
+	if err != nil {
+		return 0, err
+	}
+	newCreate, err := createTableSQL(m.to, t, t.Name, m.d, m.opts)
+	if err != nil {
+		return 0, err
+	}
+	if oldCreate == newCreate {
+		return tableUnchanged, nil
+	}
+
+	if len(t.Columns) <= len(old.Columns) {
+		return tableRebuild, nil
+	}
+	if !slices.Equal(tableConstraints(m.from, old, m.d, m.opts), tableConstraints(m.to, t, m.d, m.opts)) {
+		return tableRebuild, nil
+	}
+	for i, c := range old.Columns {
+		oldDef, err := columnDefinition(m.from, old, c, m.d)
+		if err != nil {
+			return 0, err
+		}
+		newDef, err := columnDefinition(m.to, t, t.Columns[i], m.d)
+		if err != nil {
+			return 0, err
+		}
+		if oldDef != newDef {
+			return tableRebuild, nil
+		}
+	}
+	for _, c := range t.Columns[len(old.Columns):] {
+		if !addableColumn(t, c) {
+			return tableRebuild, nil
+		}
+	}
+	return tableAddColumns, nil
+}
+
+// addableColumn reports whether SQLite's ALTER TABLE ADD COLUMN accepts c.
+// It can't add a key, and a NOT NULL column needs a default to fill the
+// existing rows with.
+func addableColumn(t *model.Table, c model.Column) bool {
+	if t.IsPK(c.Name) || c.Unique {
+		return false
+	}
+	if c.NotNull && (c.Default == nil || c.Default.Kind == model.ValueKindNull) {
+		return false
+	}
+	return true
+}
+
+// rebuild replaces old with t using SQLite's create, copy, drop and rename
+// sequence. Columns present in both keep their values; the others take
+// their default.
+func (m migration) rebuild(old, t *model.Table) ([]string, error) {
+	temp := m.tempName(t.Name)
+	create, err := createTableSQL(m.to, t, temp, m.d, m.opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var shared []string
+	for _, c := range t.Columns {
+		if _, ok := old.ColumnIndex(c.Name); ok {
+			shared = append(shared, c.Name)
+		}
+	}
+
+	stmts := []string{create}
+	if len(shared) > 0 {
+		cols := quoteIdentList(m.d, shared)
+		stmts = append(stmts, fmt.Sprintf("INSERT INTO %s (%s) SELECT %s FROM %s;\n",
+			m.d.tableName(temp), cols, cols, m.d.tableName(old.Name)))
+	}
+	stmts = append(stmts,
+		fmt.Sprintf("DROP TABLE %s;\n", m.d.tableName(old.Name)),
+		fmt.Sprintf("ALTER TABLE %s RENAME TO %s;\n", m.d.tableName(temp), m.d.quoteIdent(t.Name)),
+	)
+	return stmts, nil
+}
+
+// tempName picks a name for the table being rebuilt that neither schema
+// uses.
+func (m migration) tempName(name string) string {
+	temp := "new_" + name
+	for {
+		_, inOld := m.from.TableByName(temp)
+		_, inNew := m.to.TableByName(temp)
+		if !inOld && !inNew {
+			return temp
+		}
+		temp = "_" + temp
+	}
+}
+
+// indexes renders every index in db by name, so that a changed index
+// compares unequal.
+func (m migration) indexes(db *model.Database) map[string]string {
+	out := make(map[string]string)
+	for _, t := range db.Tables {
+		for _, idx := range t.Indexes {
+			out[idx.Name] = createIndexSQL(t, idx, m.d, m.opts)
+		}
+	}
+	return out
+}
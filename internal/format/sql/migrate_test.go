@@ -0,0 +1,186 @@
+package sql
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"sqlon/internal/model"
+)
+
+func migrationSchema() *model.Database {
+	return &model.Database{
+		Tables: []*model.Table{
+			{
+				Name: "people",
+				Columns: []model.Column{
+					{Name: "id", Type: model.ColumnTypeInt},
+					{Name: "name", Type: model.ColumnTypeText, NotNull: true},
+				},
+				PK:      []string{"id"},
+				Indexes: []model.Index{{Name: "people_name", Columns: []string{"name"}}},
+			},
+			{
+				Name: "posts",
+				Columns: []model.Column{
+					{Name: "id", Type: model.ColumnTypeInt},
+					{Name: "author_id", Type: model.ColumnTypeInt},
+					{Name: "score", Type: model.ColumnTypeInt},
+				},
+				PK:          []string{"id"},
+				ForeignKeys: []model.ForeignKey{{Name: "author_id", ReferencedTable: "people", ReferencedColumn: "id"}},
+			},
+		},
+	}
+}
+
+func migrate(t *testing.T, from, to *model.Database) string {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := ExportMigration(&buf, from, to, ExportOptions{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	return buf.String()
+}
+
+func TestMigrationUnchanged(t *testing.T) {
+	if out := migrate(t, migrationSchema(), migrationSchema()); out != "" {
+		t.Errorf("expected no output for identical schemas, got:\n%s", out)
+	}
+}
+
+func TestMigrationAddsColumns(t *testing.T) {
+	to := migrationSchema()
+	people, _ := to.TableByName("people")
+	def := model.BoolValue(true)
+	people.Columns = append(people.Columns,
+		model.Column{Name: "email", Type: model.ColumnTypeText},
+		model.Column{Name: "active", Type: model.ColumnTypeBool, NotNull: true, Default: &def},
+	)
+
+	out := migrate(t, migrationSchema(), to)
+	want := "PRAGMA foreign_keys=OFF;\nBEGIN;\n\n" +
+		"ALTER TABLE \"people\" ADD COLUMN \"email\" TEXT;\n" +
+		"ALTER TABLE \"people\" ADD COLUMN \"active\" BOOLEAN NOT NULL DEFAULT 1;\n\n" +
+		"PRAGMA foreign_key_check;\nCOMMIT;\nPRAGMA foreign_keys=ON;\n"
+	if out != want {
+		t.Errorf("unexpected migration:\n%s\nwant:\n%s", out, want)
+	}
+}
+
+func TestMigrationRebuildsChangedTable(t *testing.T) {
+	to := migrationSchema()
+	people, _ := to.TableByName("people")
+	// A new NOT NULL column without a default can't be added in place
+	people.Columns = append(people.Columns, model.Column{Name: "email", Type: model.ColumnTypeText, NotNull: true})
+
+	out := migrate(t, migrationSchema(), to)
+	for _, want := range []string{
+		`CREATE TABLE "new_people" (`,
+		`INSERT INTO "new_people" ("id", "name") SELECT "id", "name" FROM "people";`,
+		`DROP TABLE "people";`,
+		`ALTER TABLE "new_people" RENAME TO "people";`,
+		`CREATE INDEX "people_name" ON "people" ("name");`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected migration to contain %s, got:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "DROP INDEX") {
+		t.Errorf("unchanged index dropped explicitly:\n%s", out)
+	}
+}
+
+func TestMigrationTypeChangeRebuilds(t *testing.T) {
+	to := migrationSchema()
+	posts, _ := to.TableByName("posts")
+	posts.Columns[2].Type = model.ColumnTypeDecimal
+
+	out := migrate(t, migrationSchema(), to)
+	for _, want := range []string{
+		`"score" DECIMAL_TEXT`,
+		`INSERT INTO "new_posts" ("id", "author_id", "score") SELECT "id", "author_id", "score" FROM "posts";`,
+		`ALTER TABLE "new_posts" RENAME TO "posts";`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected migration to contain %s, got:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, `TABLE "people"`) {
+		t.Errorf("unchanged table touched:\n%s", out)
+	}
+}
+
+func TestMigrationAddsAndDropsTables(t *testing.T) {
+	from := migrationSchema()
+	from.Tables = append(from.Tables, &model.Table{
+		Name:        "comments",
+		Columns:     []model.Column{{Name: "post_id", Type: model.ColumnTypeInt}},
+		ForeignKeys: []model.ForeignKey{{Name: "post_id", ReferencedTable: "posts", ReferencedColumn: "id"}},
+	})
+
+	to := &model.Database{
+		Tables: []*model.Table{
+			{
+				Name:        "tags",
+				Columns:     []model.Column{{Name: "post_id", Type: model.ColumnTypeInt}, {Name: "tag", Type: model.ColumnTypeText}},
+				ForeignKeys: []model.ForeignKey{{Name: "post_id", ReferencedTable: "posts", ReferencedColumn: "id"}},
+				Indexes:     []model.Index{{Name: "tags_tag", Columns: []string{"tag"}, Unique: true}},
+			},
+			{
+				Name:    "posts",
+				Columns: []model.Column{{Name: "id", Type: model.ColumnTypeInt}},
+				PK:      []string{"id"},
+			},
+		},
+	}
+
+	out := migrate(t, from, to)
+
+	// Children are dropped before their parents and created after them
+	order := []string{
+		`DROP TABLE "comments";`,
+		`DROP TABLE "people";`,
+		`CREATE TABLE "new_posts" (`,
+		`CREATE TABLE "tags" (`,
+		`CREATE UNIQUE INDEX "tags_tag" ON "tags" ("tag");`,
+	}
+	last := -1
+	for _, want := range order {
+		i := strings.Index(out, want)
+		if i < 0 {
+			t.Fatalf("expected migration to contain %s, got:\n%s", want, out)
+		}
+		if i < last {
+			t.Errorf("%s is out of order in:\n%s", want, out)
+		}
+		last = i
+	}
+	if strings.Contains(out, `DROP INDEX "people_name"`) {
+		t.Errorf("index of a dropped table dropped explicitly:\n%s", out)
+	}
+}
+
+func TestMigrationReplacesChangedIndex(t *testing.T) {
+	to := migrationSchema()
+	people, _ := to.TableByName("people")
+	people.Indexes[0].Unique = true
+
+	out := migrate(t, migrationSchema(), to)
+	drop := strings.Index(out, `DROP INDEX "people_name";`)
+	create := strings.Index(out, `CREATE UNIQUE INDEX "people_name" ON "people" ("name");`)
+	if drop < 0 || create < drop {
+		t.Errorf("expected the index to be dropped and recreated, got:\n%s", out)
+	}
+	if strings.Contains(out, "TABLE") {
+		t.Errorf("index change touched a table:\n%s", out)
+	}
+}
+
+func TestMigrationRejectsOtherDialects(t *testing.T) {
+	var buf bytes.Buffer
+	err := ExportMigration(&buf, migrationSchema(), migrationSchema(), ExportOptions{Dialect: DialectPostgres})
+	if err == nil {
+		t.Fatal("expected an error for a postgres migration")
+	}
+}
@@ -0,0 +1,273 @@
+package sql
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"sqlon/internal/model"
+)
+
+// mysqlDialect writes MySQL (and MariaDB) with InnoDB tables in utf8mb4.
+// Enums are inlined as native ENUM column types, so it needs the database.
+type mysqlDialect struct {
+	db     *model.Database
+	schema string
+}
+
+// Widest DECIMAL MySQL supports. Values needing more digits are rounded by
+// the server.
+const (
+	mysqlMaxPrecision = 65
+	mysqlMaxScale     = 30
+)
+
+func (d mysqlDialect) preamble(w io.Writer, db *model.Database) error {
+	_, err := io.WriteString(w, "SET NAMES utf8mb4;\n\n")
+	return err
+}
+
+func (d mysqlDialect) quoteIdent(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
+
+func (d mysqlDialect) tableName(name string) string {
+	if d.schema == "" {
+		return d.quoteIdent(name)
+	}
+	return d.quoteIdent(d.schema) + "." + d.quoteIdent(name)
+}
+
+func (d mysqlDialect) columnType(t *model.Table, c model.Column) string {
+	switch c.Type {
+	case model.ColumnTypeInt:
+		if identityColumn(t, c) {
+			return "BIGINT AUTO_INCREMENT"
+		}
+		return "BIGINT"
+	case model.ColumnTypeText:
+		// TEXT can't be keyed without a prefix length or take a literal
+		// default, so such columns get a bounded VARCHAR instead
+		if d.keyed(t, c) || c.Default != nil {
+			return "VARCHAR(255)"
+		}
+		return "TEXT"
+	case model.ColumnTypeBool:
+		return "TINYINT(1)"
+	case model.ColumnTypeDecimal:
+		return mysqlDecimalType(t, c)
+	case model.ColumnTypeDatetime:
+		return "DATETIME(6)"
+	case model.ColumnTypeNull:
+		return "TEXT"
+	case model.ColumnTypeBlob:
+		return "LONGBLOB"
+	case model.ColumnTypeEnum:
+		e, ok := d.db.EnumByName(c.Enum)
+		if !ok {
+			return "TEXT"
+		}
+		values := make([]string, 0, len(e.Values))
+		for _, v := range e.Values {
+			values = append(values, d.literal(model.TextValue(v)))
+		}
+		return "ENUM(" + strings.Join(values, ", ") + ")"
+	default:
+		return "TEXT"
+	}
+}
+
+// keyed reports whether c is part of a key or index, either of its own
+// table or as the parent column of another table's foreign key.
+func (d mysqlDialect) keyed(t *model.Table, c model.Column) bool {
+	if c.Unique || t.IsPK(c.Name) {
+		return true
+	}
+	for _, idx := range t.Indexes {
+		for _, name := range idx.Columns {
+			if name == c.Name {
+				return true
+			}
+		}
+	}
+	for _, fk := range t.ForeignKeys {
+		if fk.Name == c.Name {
+			return true
+		}
+	}
+	for _, other := range d.db.Tables {
+		for _, fk := range other.ForeignKeys {
+			if fk.ReferencedTable == t.Name && fk.ReferencedColumn == c.Name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// mysqlDecimalType sizes a DECIMAL(p,s) to fit every value in the column,
+// including its default.
+func mysqlDecimalType(t *model.Table, c model.Column) string {
+	i, ok := t.ColumnIndex(c.Name)
+	if !ok {
+		return fmt.Sprintf("DECIMAL(%d,%d)", mysqlMaxPrecision, mysqlMaxScale)
+	}
+
+	values := make([]model.Value, 0, len(t.Rows)+1)
+	for _, row := range t.Rows {
+		if i < len(row) {
+			values = append(values, row[i])
+		}
+	}
+	if c.Default != nil {
+		values = append(values, *c.Default)
+	}
+
+	intDigits, scale, seen := 0, 0, false
+	for _, v := range values {
+		var plain string
+		switch v.Kind {
+		case model.ValueKindDecimal:
+			plain = plainDecimal(v.Decimal)
+		case model.ValueKindInt:
+			plain = fmt.Sprintf("%d", v.Int64)
+		default:
+			continue
+		}
+		seen = true
+		plain = strings.TrimPrefix(plain, "-")
+		ip, fp, _ := strings.Cut(plain, ".")
+		ip = strings.TrimLeft(ip, "0")
+		intDigits = max(intDigits, len(ip))
+		scale = max(scale, len(fp))
+	}
+	if !seen {
+		return fmt.Sprintf("DECIMAL(%d,%d)", mysqlMaxPrecision, mysqlMaxScale)
+	}
+
+	scale = min(scale, mysqlMaxScale)
+	precision := min(max(intDigits+scale, 1), mysqlMaxPrecision)
+	return fmt.Sprintf("DECIMAL(%d,%d)", precision, scale)
+}
+
+// plainDecimal writes d without an exponent, e.g. "1.5e2" as "150". MySQL
+// reads exponent literals as approximate floating point values, whereas
+// plain ones are exact.
+func plainDecimal(d model.Decimal) string {
+	s := d.String()
+	sign := ""
+	if strings.HasPrefix(s, "-") {
+		sign, s = "-", s[1:]
+	}
+
+	mantissa, exp := s, 0
+	if i := strings.IndexAny(s, "eE"); i >= 0 {
+		mantissa = s[:i]
+		exp, _ = strconv.Atoi(s[i+1:])
+	}
+	if exp == 0 {
+		return sign + mantissa
+	}
+
+	ip, fp, _ := strings.Cut(mantissa, ".")
+	digits := ip + fp
+	point := len(ip) + exp
+
+	var out string
+	switch {
+	case point <= 0:
+		out = "0." + strings.Repeat("0", -point) + digits
+	case point >= len(digits):
+		out = digits + strings.Repeat("0", point-len(digits))
+	default:
+		out = digits[:point] + "." + digits[point:]
+	}
+
+	// Shifting the point may leave leading zeros, e.g. "0.5e1" as "05"
+	if ip, fp, ok := strings.Cut(out, "."); ok {
+		out = trimLeadingZeros(ip) + "." + fp
+	} else {
+		out = trimLeadingZeros(out)
+	}
+	return sign + out
+}
+
+func trimLeadingZeros(s string) string {
+	s = strings.TrimLeft(s, "0")
+	if s == "" {
+		return "0"
+	}
+	return s
+}
+
+// enumConstraint returns nothing: enum columns use MySQL's ENUM type.
+func (d mysqlDialect) enumConstraint(c model.Column, e *model.Enum) string {
+	return ""
+}
+
+func (d mysqlDialect) literal(v model.Value) string {
+	switch v.Kind {
+	case model.ValueKindNull:
+		return "NULL"
+	case model.ValueKindInt:
+		return fmt.Sprintf("%d", v.Int64)
+	case model.ValueKindDecimal:
+		return plainDecimal(v.Decimal)
+	case model.ValueKindBool:
+		if v.Bool {
+			return "1"
+		}
+		return "0"
+	case model.ValueKindText:
+		return mysqlString(v.Text)
+	case model.ValueKindDatetime:
+		// DATETIME has no time zone; values are stored in UTC
+		return "'" + v.Time.UTC().Format("2006-01-02 15:04:05.999999") + "'"
+	case model.ValueKindBlob:
+		return fmt.Sprintf("X'%X'", v.Bytes)
+	default:
+		return "NULL"
+	}
+}
+
+// mysqlString quotes s using MySQL's backslash escapes, which apply unless
+// the server runs with NO_BACKSLASH_ESCAPES.
+func mysqlString(s string) string {
+	var b strings.Builder
+	b.WriteString("'")
+	for _, r := range s {
+		switch r {
+		case 0:
+			b.WriteString(`\0`)
+		case '\'':
+			b.WriteString(`\'`)
+		case '"':
+			b.WriteString(`\"`)
+		case '\b':
+			b.WriteString(`\b`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		case 0x1a:
+			b.WriteString(`\Z`)
+		case '\\':
+			b.WriteString(`\\`)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	b.WriteString("'")
+	return b.String()
+}
+
+func (d mysqlDialect) tableOptions() string {
+	return " ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci"
+}
+
+func (d mysqlDialect) afterInserts(w io.Writer, t *model.Table) error {
+	return nil
+}
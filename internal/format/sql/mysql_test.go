@@ -0,0 +1,70 @@
+package sql
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"sqlon/internal/model"
+)
+
+func TestMySQLExport(t *testing.T) {
+	db := &model.Database{
+		Enums: []model.Enum{{Name: "status", Values: []string{"draft", "live"}}},
+		Tables: []*model.Table{
+			{
+				Name: "posts",
+				Columns: []model.Column{
+					{Name: "slug", Type: model.ColumnTypeText},
+					{Name: "body", Type: model.ColumnTypeText},
+					{Name: "published", Type: model.ColumnTypeBool},
+					{Name: "price", Type: model.ColumnTypeDecimal},
+					{Name: "status", Type: model.ColumnTypeEnum, Enum: "status"},
+				},
+				PK: []string{"slug"},
+				Rows: []model.Row{
+					{model.TextValue("a"), model.TextValue("it's a \\ path\n"), model.BoolValue(true), model.DecimalValue("19.90"), model.TextValue("live")},
+					{model.TextValue("b"), model.NullValue(), model.BoolValue(false), model.DecimalValue("1.5e3"), model.TextValue("draft")},
+				},
+			},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := Export(&buf, db, ExportOptions{Dialect: DialectMySQL}); err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	out := buf.String()
+
+	for _, want := range []string{
+		"CREATE TABLE `posts` (",
+		"`slug` VARCHAR(255) PRIMARY KEY",
+		"`body` TEXT",
+		"`published` TINYINT(1)",
+		"`price` DECIMAL(6,2)",
+		"`status` ENUM('draft', 'live')",
+		") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;",
+		`VALUES ('a', 'it\'s a \\ path\n', 1, 19.90, 'live');`,
+		`VALUES ('b', NULL, 0, 1500, 'draft');`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected output to contain %s, got:\n%s", want, out)
+		}
+	}
+}
+
+func TestPlainDecimal(t *testing.T) {
+	cases := map[model.Decimal]string{
+		"19.90":    "19.90",
+		"1e+06":    "1000000",
+		"-2.50E-3": "-0.00250",
+		"0.5e1":    "5",
+		"1.25e1":   "12.5",
+		"-0":       "-0",
+	}
+	for in, want := range cases {
+		if got := plainDecimal(in); got != want {
+			t.Errorf("plainDecimal(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -1,11 +1,13 @@
 package sql
 
 import (
+	"encoding/hex"
 	"fmt"
 	"io"
-	"regexp"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
 
 	"sqlon/internal/model"
 )
@@ -17,385 +19,1182 @@ func ParseSQLite(r io.Reader) (*model.Database, error) {
 		return nil, err
 	}
 
-	db := &model.Database{}
-	sql := string(content)
-
-	// Split by statements (semicolon followed by newline or end)
-	statements := splitSQLStatements(sql)
+	toks, err := lex(string(content))
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{toks: toks, skipped: map[string]bool{}}
 
-	var currentTable *model.Table
+	db := &model.Database{}
 
-	for _, stmt := range statements {
-		stmt = strings.TrimSpace(stmt)
-		if stmt == "" {
+	for p.peek().kind != tokenEOF {
+		if p.accept(";") {
 			continue
 		}
 
-		upperStmt := strings.ToUpper(stmt)
-
-		if strings.HasPrefix(upperStmt, "CREATE TABLE") {
-			table, err := parseCreateTable(stmt)
+		switch {
+		case p.peek().is("CREATE") && p.createKind() == "TABLE":
+			table, enums, err := p.parseCreateTable()
 			if err != nil {
 				return nil, err
 			}
-			currentTable = table
+			if p.isShadowTable(table.Name) {
+				// A virtual table's storage is rebuilt with the table
+				p.skipped[table.Name] = true
+				break
+			}
+			if err := addEnums(db, enums); err != nil {
+				return nil, err
+			}
 			db.Tables = append(db.Tables, table)
-		} else if strings.HasPrefix(upperStmt, "INSERT INTO") {
-			if currentTable == nil {
-				return nil, fmt.Errorf("INSERT statement before CREATE TABLE")
+		case p.peek().is("CREATE") && p.createKind() == "INDEX":
+			if err := p.parseCreateIndex(db); err != nil {
+				return nil, err
+			}
+		case p.peek().is("CREATE") && p.createKind() == "VIRTUAL":
+			// A virtual table's rows live in its module, not in SQL
+			if err := p.parseCreateVirtualTable(); err != nil {
+				return nil, err
 			}
-			row, err := parseInsert(stmt, currentTable)
+		case p.peek().is("CREATE") && p.createKind() == "TRIGGER":
+			// A trigger body holds statements of its own, semicolons and all
+			p.skipTrigger()
+		case p.peek().is("INSERT"):
+			table, rows, err := p.parseInsert(db)
 			if err != nil {
 				return nil, err
 			}
-			if row != nil {
-				currentTable.Rows = append(currentTable.Rows, row)
+			if table != nil {
+				table.Rows = append(table.Rows, rows...)
 			}
+		default:
+			// PRAGMA, transactions and anything else have no bearing on
+			// the data and are skipped
+			p.skipStatement()
+			continue
+		}
+
+		if err := p.endStatement(); err != nil {
+			return nil, err
 		}
 	}
 
+	resolveForeignKeys(db)
+	demoteDatetimeColumns(db)
+
 	return db, nil
 }
 
-func splitSQLStatements(sql string) []string {
-	var statements []string
-	var current strings.Builder
-	depth := 0
-	inString := false
-
-	for i := 0; i < len(sql); i++ {
-		ch := sql[i]
-
-		if inString {
-			if ch == '\'' && i+1 < len(sql) && sql[i+1] == '\'' {
-				// Escaped quote
-				current.WriteByte(ch)
-				current.WriteByte(sql[i+1])
-				i++
+// demoteDatetimeColumns turns DATETIME columns holding text that isn't a
+// timestamp into text columns, since SQLite stores whatever it is given.
+func demoteDatetimeColumns(db *model.Database) {
+	for _, t := range db.Tables {
+		for i := range t.Columns {
+			if t.Columns[i].Type != model.ColumnTypeDatetime || !columnHasKind(t, i, model.ValueKindText) {
 				continue
 			}
-			if ch == '\'' {
-				inString = false
+			t.Columns[i].Type = model.ColumnTypeText
+			for _, row := range t.Rows {
+				if i < len(row) && row[i].Kind == model.ValueKindDatetime {
+					row[i] = model.TextValue(model.FormatDatetime(row[i].Time))
+				}
+			}
+			if d := t.Columns[i].Default; d != nil && d.Kind == model.ValueKindDatetime {
+				v := model.TextValue(model.FormatDatetime(d.Time))
+				t.Columns[i].Default = &v
 			}
-			current.WriteByte(ch)
+		}
+	}
+}
+
+func columnHasKind(t *model.Table, i int, kind model.ValueKind) bool {
+	if d := t.Columns[i].Default; d != nil && d.Kind == kind {
+		return true
+	}
+	for _, row := range t.Rows {
+		if i < len(row) && row[i].Kind == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// parser walks the token stream one statement at a time.
+type parser struct {
+	toks []token
+	pos  int
+
+	// virtual holds the names of virtual tables seen so far, and skipped
+	// the tables, virtual or shadow, whose inserts are ignored.
+	virtual []string
+	skipped map[string]bool
+}
+
+func (p *parser) peek() token {
+	return p.peekAt(0)
+}
+
+// peekAt looks n tokens ahead; past the end it returns the EOF token.
+func (p *parser) peekAt(n int) token {
+	if p.pos+n < len(p.toks) {
+		return p.toks[p.pos+n]
+	}
+	return p.toks[len(p.toks)-1]
+}
+
+func (p *parser) next() token {
+	tok := p.peek()
+	if tok.kind != tokenEOF {
+		p.pos++
+	}
+	return tok
+}
+
+// accept consumes the next token if it is the keyword or punctuation s.
+func (p *parser) accept(s string) bool {
+	if p.peek().is(s) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(s string) error {
+	if !p.accept(s) {
+		tok := p.peek()
+		return errorAt(tok.pos, "expected %s, found %s", s, tok)
+	}
+	return nil
+}
+
+// acceptSeq consumes the keywords in seq if they all follow in order.
+func (p *parser) acceptSeq(seq ...string) bool {
+	for i, s := range seq {
+		if !p.peekAt(i).is(s) {
+			return false
+		}
+	}
+	p.pos += len(seq)
+	return true
+}
+
+// name reads an identifier, bare or quoted. As in SQLite, a string such
+// as 't' is read as a name too. A schema-qualified name such as main.t
+// yields just the final part.
+func (p *parser) name() (string, error) {
+	tok := p.peek()
+	if tok.kind != tokenWord && tok.kind != tokenIdent && tok.kind != tokenString {
+		return "", errorAt(tok.pos, "expected a name, found %s", tok)
+	}
+	p.pos++
+	if p.peek().is(".") {
+		p.pos++
+		return p.name()
+	}
+	return tok.text, nil
+}
+
+// createKind returns the object kind of the CREATE statement at the
+// cursor, e.g. "TABLE" or "INDEX", skipping TEMP and UNIQUE modifiers.
+func (p *parser) createKind() string {
+	for i := 1; ; i++ {
+		tok := p.peekAt(i)
+		if tok.is("TEMP") || tok.is("TEMPORARY") || tok.is("UNIQUE") {
 			continue
 		}
+		return strings.ToUpper(tok.text)
+	}
+}
 
-		switch ch {
-		case '\'':
-			inString = true
-			current.WriteByte(ch)
-		case '(':
+// skipGroup consumes a parenthesised group, starting at its "(".
+func (p *parser) skipGroup() {
+	depth := 0
+	for {
+		tok := p.next()
+		switch {
+		case tok.kind == tokenEOF:
+			return
+		case tok.is("("):
 			depth++
-			current.WriteByte(ch)
-		case ')':
+		case tok.is(")"):
 			depth--
-			current.WriteByte(ch)
-		case ';':
 			if depth == 0 {
-				stmt := strings.TrimSpace(current.String())
-				if stmt != "" {
-					statements = append(statements, stmt)
-				}
-				current.Reset()
-			} else {
-				current.WriteByte(ch)
+				return
 			}
+		}
+	}
+}
+
+// skipStatement consumes tokens up to and including the next top-level ";".
+func (p *parser) skipStatement() {
+	p.skipToStatementEnd()
+	p.accept(";")
+}
+
+// skipToStatementEnd consumes tokens up to, but not including, the next
+// top-level ";".
+func (p *parser) skipToStatementEnd() {
+	for {
+		tok := p.peek()
+		switch {
+		case tok.kind == tokenEOF, tok.is(";"):
+			return
+		case tok.is("("):
+			p.skipGroup()
 		default:
-			current.WriteByte(ch)
+			p.pos++
 		}
 	}
+}
 
-	// Add final statement if any
-	stmt := strings.TrimSpace(current.String())
-	if stmt != "" {
-		statements = append(statements, stmt)
+// skipTrigger consumes a CREATE TRIGGER statement up to the END that
+// closes its body. CASE expressions inside the body have their own END.
+func (p *parser) skipTrigger() {
+	for tok := p.next(); tok.kind != tokenEOF && !tok.is("BEGIN"); tok = p.next() {
+	}
+	depth := 0
+	for tok := p.next(); tok.kind != tokenEOF; tok = p.next() {
+		switch {
+		case tok.is("CASE"):
+			depth++
+		case tok.is("END"):
+			if depth == 0 {
+				return
+			}
+			depth--
+		}
 	}
+}
 
-	return statements
+// endStatement requires the statement just parsed to be finished.
+func (p *parser) endStatement() error {
+	tok := p.peek()
+	if tok.kind == tokenEOF || p.accept(";") {
+		return nil
+	}
+	return errorAt(tok.pos, "expected ; after statement, found %s", tok)
 }
 
-var createTableRegex = regexp.MustCompile(`(?i)CREATE\s+TABLE\s+"?([^"\s(]+)"?\s*\(`)
+// skipToDefinitionEnd consumes the rest of a column or constraint
+// definition, stopping before the "," or ")" that ends it.
+func (p *parser) skipToDefinitionEnd() {
+	for {
+		tok := p.peek()
+		switch {
+		case tok.kind == tokenEOF, tok.is(","), tok.is(")"), tok.is(";"):
+			return
+		case tok.is("("):
+			p.skipGroup()
+		default:
+			p.pos++
+		}
+	}
+}
 
-func parseCreateTable(sql string) (*model.Table, error) {
-	matches := createTableRegex.FindStringSubmatch(sql)
-	if len(matches) < 2 {
-		return nil, fmt.Errorf("could not parse table name from CREATE TABLE")
+// nameList reads a parenthesised list of column names. Ordering and
+// collation after each name, as in (a DESC, b COLLATE NOCASE), is ignored.
+func (p *parser) nameList() ([]string, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	var names []string
+	for {
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+		p.skipToDefinitionEnd()
+		if p.accept(")") {
+			return names, nil
+		}
+		if err := p.expect(","); err != nil {
+			return nil, err
+		}
 	}
-	tableName := strings.Trim(matches[1], `"`)
+}
 
-	// Extract column definitions
-	start := strings.Index(sql, "(")
-	end := strings.LastIndex(sql, ")")
-	if start == -1 || end == -1 {
-		return nil, fmt.Errorf("invalid CREATE TABLE syntax")
+func (p *parser) parseCreateTable() (*model.Table, []model.Enum, error) {
+	p.next() // CREATE
+	if !p.accept("TEMP") {
+		p.accept("TEMPORARY")
 	}
+	if err := p.expect("TABLE"); err != nil {
+		return nil, nil, err
+	}
+	p.acceptSeq("IF", "NOT", "EXISTS")
 
-	colsDef := sql[start+1 : end]
-	columns, pk, err := parseColumns(colsDef)
+	tableName, err := p.name()
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+	if tok := p.peek(); tok.is("AS") {
+		return nil, nil, errorAt(tok.pos, "CREATE TABLE %q AS SELECT is not supported", tableName)
+	}
+	if err := p.expect("("); err != nil {
+		return nil, nil, err
 	}
 
-	table := &model.Table{
-		Name:    tableName,
-		Columns: columns,
-		PK:      pk,
+	table := &model.Table{Name: tableName}
+	enums, err := p.parseColumns(table)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	return table, nil
+	// Table options such as WITHOUT ROWID or STRICT
+	p.skipToStatementEnd()
+
+	return table, enums, nil
 }
 
-func parseColumns(colsDef string) ([]model.Column, string, error) {
-	columns := []model.Column{}
-	pk := ""
+// parseCreateVirtualTable reads a CREATE VIRTUAL TABLE statement up to its
+// end, noting the table's name.
+func (p *parser) parseCreateVirtualTable() error {
+	p.next() // CREATE
+	if err := p.expect("VIRTUAL"); err != nil {
+		return err
+	}
+	if err := p.expect("TABLE"); err != nil {
+		return err
+	}
+	p.acceptSeq("IF", "NOT", "EXISTS")
+	name, err := p.name()
+	if err != nil {
+		return err
+	}
+	p.virtual = append(p.virtual, name)
+	p.skipped[name] = true
+	p.skipToStatementEnd()
+	return nil
+}
 
-	// Split by comma, but be careful with parentheses
-	parts := splitColumnDefinitions(colsDef)
+// shadowSuffixes are the suffixes of the tables the FTS3/4, FTS5 and
+// R*Tree modules keep a virtual table's data in.
+var shadowSuffixes = []string{
+	"_data", "_idx", "_content", "_docsize", "_config",
+	"_segments", "_segdir", "_stat",
+	"_node", "_rowid", "_parent",
+}
 
-	for _, part := range parts {
-		part = strings.TrimSpace(part)
-		if part == "" {
-			continue
+// isShadowTable reports whether name is a table backing one of the
+// virtual tables seen so far.
+func (p *parser) isShadowTable(name string) bool {
+	for _, vt := range p.virtual {
+		rest, ok := strings.CutPrefix(strings.ToLower(name), strings.ToLower(vt))
+		if ok && slices.Contains(shadowSuffixes, rest) {
+			return true
 		}
+	}
+	return false
+}
 
-		// Check for PRIMARY KEY
-		if strings.Contains(strings.ToUpper(part), "PRIMARY KEY") {
-			// Extract column name before PRIMARY KEY
-			pkMatch := regexp.MustCompile(`"([^"]+)"`).FindStringSubmatch(part)
-			if len(pkMatch) >= 2 {
-				pk = pkMatch[1]
+// noteVirtualTables reads an INSERT into sqlite_schema, which is how
+// sqlite3 .dump declares virtual tables, from its column list on, and
+// notes the virtual tables it creates.
+func (p *parser) noteVirtualTables() error {
+	if p.peek().is("(") {
+		p.skipGroup()
+	}
+	if err := p.expect("VALUES"); err != nil {
+		return err
+	}
+	for {
+		lits, err := p.parseTuple()
+		if err != nil {
+			return err
+		}
+		for _, lit := range lits {
+			if lit.tok.kind != tokenString {
+				continue
+			}
+			toks, err := lex(lit.tok.text)
+			if err != nil {
+				continue
 			}
-			// Remove PRIMARY KEY part
-			part = regexp.MustCompile(`\s+PRIMARY\s+KEY.*`).ReplaceAllString(part, "")
+			stmt := &parser{toks: toks, skipped: p.skipped}
+			if stmt.peek().is("CREATE") && stmt.createKind() == "VIRTUAL" && stmt.parseCreateVirtualTable() == nil {
+				p.virtual = append(p.virtual, stmt.virtual...)
+			}
+		}
+		if !p.accept(",") {
+			break
 		}
+	}
+	p.skipToStatementEnd()
+	return nil
+}
 
-		// Parse column name and type
-		colParts := strings.Fields(part)
-		if len(colParts) < 2 {
+func (p *parser) parseCreateIndex(db *model.Database) error {
+	p.next() // CREATE
+	unique := p.accept("UNIQUE")
+	if err := p.expect("INDEX"); err != nil {
+		return err
+	}
+	p.acceptSeq("IF", "NOT", "EXISTS")
+
+	name, err := p.name()
+	if err != nil {
+		return err
+	}
+	if err := p.expect("ON"); err != nil {
+		return err
+	}
+	tableTok := p.peek()
+	tableName, err := p.name()
+	if err != nil {
+		return err
+	}
+	table, ok := db.TableByName(tableName)
+	if !ok {
+		return errorAt(tableTok.pos, "CREATE INDEX on unknown table %q", tableName)
+	}
+	columns, err := p.nameList()
+	if err != nil {
+		return err
+	}
+
+	// A partial index's WHERE clause is not part of the model
+	p.skipToStatementEnd()
+
+	table.Indexes = append(table.Indexes, model.Index{Name: name, Columns: columns, Unique: unique})
+	return nil
+}
+
+// addEnums merges enums recovered from a CREATE TABLE into db. An enum
+// shared by several columns is declared once; a name reused with different
+// values is an error.
+func addEnums(db *model.Database, enums []model.Enum) error {
+	for _, e := range enums {
+		existing, ok := db.EnumByName(e.Name)
+		if !ok {
+			db.Enums = append(db.Enums, e)
 			continue
 		}
+		if strings.Join(existing.Values, "\x00") != strings.Join(e.Values, "\x00") {
+			return fmt.Errorf("enum %q is declared with different values", e.Name)
+		}
+	}
+	return nil
+}
 
-		colName := strings.Trim(colParts[0], `"`)
-		colTypeStr := strings.ToUpper(colParts[1])
+// parseColumns fills in table's columns, primary key and foreign keys from
+// the body of a CREATE TABLE, up to and including its closing ")". It
+// returns any enums found in CHECK constraints.
+func (p *parser) parseColumns(table *model.Table) ([]model.Enum, error) {
+	var enums []model.Enum
 
-		colType := sqliteTypeToColumnType(colTypeStr)
+	for {
+		var err error
+		if p.isTableConstraint() {
+			err = p.parseTableConstraint(table)
+		} else {
+			var enum *model.Enum
+			enum, err = p.parseColumnDef(table)
+			if enum != nil {
+				enums = append(enums, *enum)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
 
-		columns = append(columns, model.Column{
-			Name: colName,
-			Type: colType,
-		})
+		if p.accept(")") {
+			return enums, nil
+		}
+		if err := p.expect(","); err != nil {
+			return nil, err
+		}
 	}
+}
 
-	return columns, pk, nil
+func (p *parser) isTableConstraint() bool {
+	tok := p.peek()
+	if tok.kind != tokenWord {
+		return false
+	}
+	for _, kw := range []string{"CONSTRAINT", "PRIMARY", "FOREIGN", "UNIQUE", "CHECK"} {
+		if tok.is(kw) {
+			return true
+		}
+	}
+	return false
 }
 
-func splitColumnDefinitions(s string) []string {
-	var parts []string
-	var current strings.Builder
-	depth := 0
+func (p *parser) parseTableConstraint(table *model.Table) error {
+	constraintName := ""
+	if p.accept("CONSTRAINT") {
+		var err error
+		if constraintName, err = p.name(); err != nil {
+			return err
+		}
+	}
 
-	for _, r := range s {
-		switch r {
-		case '(':
-			depth++
-			current.WriteRune(r)
-		case ')':
-			depth--
-			current.WriteRune(r)
-		case ',':
-			if depth == 0 {
-				parts = append(parts, current.String())
-				current.Reset()
-			} else {
-				current.WriteRune(r)
+	switch {
+	case p.acceptSeq("PRIMARY", "KEY"):
+		// Table-level PRIMARY KEY ("a", "b") constraint
+		pk, err := p.nameList()
+		if err != nil {
+			return err
+		}
+		table.PK = pk
+	case p.acceptSeq("FOREIGN", "KEY"):
+		// FOREIGN KEY ("col") REFERENCES "parent" ("id"). The model holds
+		// single-column keys only, so composite ones are dropped
+		cols, err := p.nameList()
+		if err != nil {
+			return err
+		}
+		if err := p.expect("REFERENCES"); err != nil {
+			return err
+		}
+		parent, refs, err := p.parseReferences()
+		if err != nil {
+			return err
+		}
+		if len(cols) == 1 && len(refs) <= 1 {
+			table.ForeignKeys = append(table.ForeignKeys, foreignKey(cols[0], parent, refs))
+		}
+	case p.accept("UNIQUE"):
+		// A single column is marked unique; a combination becomes a
+		// unique index
+		cols, err := p.nameList()
+		if err != nil {
+			return err
+		}
+		if i, ok := table.ColumnIndex(cols[0]); ok && len(cols) == 1 {
+			table.Columns[i].Unique = true
+			break
+		}
+		if constraintName == "" {
+			constraintName = table.Name + "_" + strings.Join(cols, "_") + "_key"
+		}
+		table.Indexes = append(table.Indexes, model.Index{Name: constraintName, Columns: cols, Unique: true})
+	}
+
+	// CHECK constraints and conflict clauses are not part of the model
+	p.skipToDefinitionEnd()
+	return nil
+}
+
+// parseReferences reads the rest of a REFERENCES clause: the parent table,
+// its optional column list, and any ON DELETE, MATCH or DEFERRABLE clauses,
+// which are not part of the model.
+func (p *parser) parseReferences() (string, []string, error) {
+	parent, err := p.name()
+	if err != nil {
+		return "", nil, err
+	}
+	var refs []string
+	if p.peek().is("(") {
+		if refs, err = p.nameList(); err != nil {
+			return "", nil, err
+		}
+	}
+
+	for {
+		switch {
+		case p.accept("ON"):
+			p.next() // DELETE or UPDATE
+			switch {
+			case p.acceptSeq("SET", "NULL"), p.acceptSeq("SET", "DEFAULT"), p.acceptSeq("NO", "ACTION"):
+			default:
+				p.next() // CASCADE or RESTRICT
+			}
+		case p.accept("MATCH"):
+			p.next()
+		case p.acceptSeq("NOT", "DEFERRABLE"), p.accept("DEFERRABLE"):
+			if p.accept("INITIALLY") {
+				p.next() // DEFERRED or IMMEDIATE
 			}
 		default:
-			current.WriteRune(r)
+			return parent, refs, nil
 		}
 	}
+}
+
+// foreignKey builds a key from col to parent. Without a column list the
+// key refers to the parent's primary key, which resolveForeignKeys fills
+// in once every table is known.
+func foreignKey(col, parent string, refs []string) model.ForeignKey {
+	fk := model.ForeignKey{Name: col, ReferencedTable: parent}
+	if len(refs) == 1 {
+		fk.ReferencedColumn = refs[0]
+	}
+	return fk
+}
 
-	if current.Len() > 0 {
-		parts = append(parts, current.String())
+// resolveForeignKeys points keys declared without a parent column at the
+// parent's primary key, and drops keys declared twice (inline and as a
+// table constraint). Keys to a parent without a single-column primary key
+// can't be represented and are dropped too.
+func resolveForeignKeys(db *model.Database) {
+	for _, t := range db.Tables {
+		kept := t.ForeignKeys[:0]
+		seen := map[model.ForeignKey]bool{}
+		for _, fk := range t.ForeignKeys {
+			if fk.ReferencedColumn == "" {
+				parent, ok := db.TableByName(fk.ReferencedTable)
+				if !ok || len(parent.PK) != 1 {
+					continue
+				}
+				fk.ReferencedColumn = parent.PK[0]
+			}
+			if seen[fk] {
+				continue
+			}
+			seen[fk] = true
+			kept = append(kept, fk)
+		}
+		t.ForeignKeys = kept
 	}
+}
 
-	return parts
+// columnConstraintWords end a column's type name.
+var columnConstraintWords = []string{
+	"CONSTRAINT", "PRIMARY", "NOT", "NULL", "UNIQUE", "CHECK", "DEFAULT",
+	"COLLATE", "REFERENCES", "GENERATED", "AS",
 }
 
+func isColumnConstraintWord(tok token) bool {
+	for _, kw := range columnConstraintWords {
+		if tok.is(kw) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseColumnDef reads one column definition into table. A CHECK
+// constraint shaped like an enum is returned as that enum.
+func (p *parser) parseColumnDef(table *model.Table) (*model.Enum, error) {
+	name, err := p.name()
+	if err != nil {
+		return nil, err
+	}
+
+	// The type name is optional and may span several words, as in
+	// UNSIGNED BIG INT, with a size such as VARCHAR(255)
+	var typeWords []string
+	for tok := p.peek(); tok.kind == tokenWord && !isColumnConstraintWord(tok); tok = p.peek() {
+		typeWords = append(typeWords, strings.ToUpper(tok.text))
+		p.pos++
+	}
+	if p.peek().is("(") && len(typeWords) > 0 {
+		p.skipGroup()
+	}
+
+	col := model.Column{
+		Name: name,
+		Type: sqliteTypeToColumnType(strings.Join(typeWords, " ")),
+	}
+
+	var enum *model.Enum
+	constraintName := ""
+	for {
+		tok := p.peek()
+		switch {
+		case tok.kind == tokenEOF, tok.is(","), tok.is(")"):
+			table.Columns = append(table.Columns, col)
+			return enum, nil
+		case p.accept("CONSTRAINT"):
+			if constraintName, err = p.name(); err != nil {
+				return nil, err
+			}
+		case p.acceptSeq("PRIMARY", "KEY"):
+			table.PK = []string{col.Name}
+			// How ExportSQLite marks a generated key
+			col.Generated = constraintName == "generated"
+			constraintName = ""
+		case p.acceptSeq("NOT", "NULL"):
+			col.NotNull = true
+		case p.accept("UNIQUE"):
+			col.Unique = true
+		case p.accept("DEFAULT"):
+			if col.Default, err = p.parseDefault(col.Type); err != nil {
+				return nil, err
+			}
+		case p.accept("REFERENCES"):
+			parent, refs, err := p.parseReferences()
+			if err != nil {
+				return nil, err
+			}
+			if len(refs) <= 1 {
+				table.ForeignKeys = append(table.ForeignKeys, foreignKey(col.Name, parent, refs))
+			}
+		case p.accept("CHECK"):
+			// CHECK ("col" IS NULL) is how null columns are exported
+			if p.parseNullCheck(col.Name) {
+				col.Type = model.ColumnTypeNull
+				break
+			}
+			// CHECK ("col" IN ('a', 'b')) is how enums are exported
+			values, ok := p.parseEnumCheck(col.Name)
+			if !ok {
+				if tok := p.peek(); !tok.is("(") {
+					return nil, errorAt(tok.pos, "expected ( after CHECK, found %s", tok)
+				}
+				p.skipGroup()
+				break
+			}
+			name := constraintName
+			if name == "" {
+				name = table.Name + "_" + col.Name
+			}
+			col.Type = model.ColumnTypeEnum
+			col.Enum = name
+			enum = &model.Enum{Name: name, Values: values}
+		case tok.is("("):
+			p.skipGroup()
+		default:
+			p.pos++
+		}
+	}
+}
+
+// parseDefault reads the value after DEFAULT. Expressions such as
+// CURRENT_TIMESTAMP have no SQLON equivalent and give no default.
+func (p *parser) parseDefault(colType model.ColumnType) (*model.Value, error) {
+	start := p.pos
+	paren := p.accept("(")
+	lit, ok := p.parseLiteral()
+	if ok && (!paren || p.accept(")")) {
+		v, err := lit.value(colType)
+		if err != nil {
+			return nil, err
+		}
+		return &v, nil
+	}
+
+	p.pos = start
+	if p.peek().is("(") {
+		p.skipGroup()
+	} else {
+		p.next()
+		if p.peek().is("(") {
+			p.skipGroup() // function call
+		}
+	}
+	return nil, nil
+}
+
+// parseNullCheck recognises the body of CHECK ("col" IS NULL) for the given
+// column, leaving the cursor where it was if it doesn't match.
+func (p *parser) parseNullCheck(col string) bool {
+	start := p.pos
+	if p.accept("(") {
+		if name, err := p.name(); err == nil && name == col && p.acceptSeq("IS", "NULL", ")") {
+			return true
+		}
+	}
+	p.pos = start
+	return false
+}
+
+// parseEnumCheck recognises the body of CHECK ("col" IN ('a', 'b')) for the
+// given column and returns the listed values. Checks of any other shape are
+// not enums, and leave the cursor where it was.
+func (p *parser) parseEnumCheck(col string) ([]string, bool) {
+	start := p.pos
+	if !p.accept("(") {
+		return nil, false
+	}
+	if name, err := p.name(); err != nil || name != col || !p.accept("IN") || !p.accept("(") {
+		p.pos = start
+		return nil, false
+	}
+
+	var values []string
+	for {
+		tok := p.next()
+		if tok.kind != tokenString {
+			p.pos = start
+			return nil, false
+		}
+		values = append(values, tok.text)
+		if p.accept(")") {
+			break
+		}
+		if !p.accept(",") {
+			p.pos = start
+			return nil, false
+		}
+	}
+	if !p.accept(")") {
+		p.pos = start
+		return nil, false
+	}
+
+	return values, true
+}
+
+// sqliteTypeToColumnType maps a declared column type to a SQLON type. The
+// names ExportSQLite writes map back exactly; anything else follows SQLite's
+// own affinity rules, so INT, BIGINT and VARCHAR(255) mean what SQLite takes
+// them to mean.
 func sqliteTypeToColumnType(sqlType string) model.ColumnType {
 	switch sqlType {
-	case "INTEGER":
+	case "BOOLEAN", "BOOL":
+		return model.ColumnTypeBool
+	case "DATETIME", "TIMESTAMP":
+		return model.ColumnTypeDatetime
+	case "DECIMAL_TEXT":
+		return model.ColumnTypeDecimal
+	}
+
+	switch {
+	case strings.Contains(sqlType, "INT"):
 		return model.ColumnTypeInt
-	case "TEXT":
+	case strings.Contains(sqlType, "CHAR"), strings.Contains(sqlType, "CLOB"), strings.Contains(sqlType, "TEXT"):
 		return model.ColumnTypeText
-	case "REAL":
+	case strings.Contains(sqlType, "BLOB"):
+		return model.ColumnTypeBlob
+	case strings.Contains(sqlType, "REAL"), strings.Contains(sqlType, "FLOA"), strings.Contains(sqlType, "DOUB"),
+		strings.Contains(sqlType, "NUMERIC"), strings.Contains(sqlType, "DECIMAL"):
 		return model.ColumnTypeDecimal
 	default:
 		return model.ColumnTypeText
 	}
 }
 
-func parseInsert(sql string, table *model.Table) (model.Row, error) {
-	// Find "VALUES (" (case insensitive)
-	upperSQL := strings.ToUpper(sql)
-	valuesIdx := strings.Index(upperSQL, "VALUES (")
-	if valuesIdx == -1 {
-		return nil, fmt.Errorf("could not find VALUES clause in INSERT statement")
+// parseInsert reads an INSERT statement and returns the table it names
+// with the rows of its VALUES list, or a nil table for inserts into
+// SQLite's internal tables and into virtual tables and their storage. Values are mapped through the statement's
+// column list, or taken positionally when it has none; columns left out
+// get their default, or null.
+func (p *parser) parseInsert(db *model.Database) (*model.Table, []model.Row, error) {
+	p.next() // INSERT
+	if p.accept("OR") {
+		p.next() // REPLACE, IGNORE, ...
+	}
+	if err := p.expect("INTO"); err != nil {
+		return nil, nil, err
+	}
+	tableTok := p.peek()
+	tableName, err := p.name()
+	if err != nil {
+		return nil, nil, err
+	}
+	table, ok := db.TableByName(tableName)
+	if !ok {
+		// sqlite3 .dump fills SQLite's own tables, such as sqlite_sequence
+		// and sqlite_stat1, without creating them
+		switch lower := strings.ToLower(tableName); {
+		case lower == "sqlite_schema" || lower == "sqlite_master":
+			return nil, nil, p.noteVirtualTables()
+		case strings.HasPrefix(lower, "sqlite_") || p.skipped[tableName]:
+			p.skipToStatementEnd()
+			return nil, nil, nil
+		}
+		return nil, nil, errorAt(tableTok.pos, "INSERT INTO unknown table %q", tableName)
+	}
+
+	// positions[i] is the table column that the i-th value belongs to
+	var positions []int
+	if p.accept("(") {
+		for {
+			colTok := p.peek()
+			name, err := p.name()
+			if err != nil {
+				return nil, nil, err
+			}
+			i, ok := table.ColumnIndex(name)
+			if !ok {
+				return nil, nil, errorAt(colTok.pos, "table %q has no column %q", table.Name, name)
+			}
+			positions = append(positions, i)
+			if p.accept(")") {
+				break
+			}
+			if err := p.expect(","); err != nil {
+				return nil, nil, err
+			}
+		}
+	} else {
+		for i := range table.Columns {
+			positions = append(positions, i)
+		}
 	}
 
-	// Skip "VALUES (" to get to the actual values
-	valuesStart := valuesIdx + 8 // len("VALUES (")
+	if err := p.expect("VALUES"); err != nil {
+		return nil, nil, err
+	}
 
-	// Find the matching closing parenthesis, respecting strings
-	valuesStr := ""
-	depth := 1
-	inString := false
-	for i := valuesStart; i < len(sql); i++ {
-		b := sql[i]
+	var rows []model.Row
+	for {
+		tupleTok := p.peek()
+		lits, err := p.parseTuple()
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(lits) != len(positions) {
+			return nil, nil, errorAt(tupleTok.pos, "%d values for %d columns of table %q", len(lits), len(positions), table.Name)
+		}
 
-		switch b {
-		case '\'':
-			if inString {
-				// Check for escaped quote ''
-				if i+1 < len(sql) && sql[i+1] == '\'' {
-					valuesStr += string(b)
-					i++ // Skip next quote
-					valuesStr += string(sql[i])
-					continue
-				}
-				inString = false
+		row := make(model.Row, len(table.Columns))
+		for i, c := range table.Columns {
+			if c.Default != nil {
+				row[i] = *c.Default
 			} else {
-				inString = true
-			}
-			valuesStr += string(b)
-		case '(':
-			if !inString {
-				depth++
-			}
-			valuesStr += string(b)
-		case ')':
-			if !inString {
-				depth--
-				if depth == 0 {
-					// Found the matching closing paren
-					break
-				}
+				row[i] = model.NullValue()
+			}
+		}
+		for n, i := range positions {
+			if row[i], err = lits[n].value(table.Columns[i].Type); err != nil {
+				return nil, nil, err
 			}
-			valuesStr += string(b)
-		default:
-			valuesStr += string(b)
 		}
+		rows = append(rows, row)
 
-		if depth == 0 {
+		if !p.accept(",") {
 			break
 		}
 	}
 
-	if depth != 0 {
-		return nil, fmt.Errorf("unmatched parentheses in VALUES clause")
-	}
+	// An ON CONFLICT or RETURNING clause doesn't change the rows given
+	p.skipToStatementEnd()
 
-	values := parseValueList(valuesStr)
+	return table, rows, nil
+}
 
-	row := make(model.Row, len(table.Columns))
-	for i := range table.Columns {
-		if i < len(values) {
-			row[i] = parseSQLValue(strings.TrimSpace(values[i]), table.Columns[i].Type)
-		} else {
-			row[i] = model.NullValue()
+// parseTuple reads a parenthesised, comma-separated list of literals.
+func (p *parser) parseTuple() ([]literal, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	var lits []literal
+	for {
+		lit, ok := p.parseLiteral()
+		if !ok {
+			tok := p.peek()
+			return nil, errorAt(tok.pos, "expected a literal value, found %s", tok)
+		}
+		lits = append(lits, lit)
+		if p.accept(")") {
+			return lits, nil
+		}
+		if err := p.expect(","); err != nil {
+			return nil, err
 		}
 	}
+}
 
-	return row, nil
+// literal is a constant from the SQL text. It is only turned into a value
+// once the type of the column it belongs to is known.
+type literal struct {
+	tok  token
+	sign string // "-" for a negated number
 }
 
-func parseValueList(s string) []string {
-	var values []string
-	var current strings.Builder
-	depth := 0
-	inString := false
-
-	bytes := []byte(s)
-	i := 0
-	for i < len(bytes) {
-		b := bytes[i]
-
-		switch b {
-		case '\'':
-			if inString {
-				// Check if it's escaped (double quote '')
-				if i+1 < len(bytes) && bytes[i+1] == '\'' {
-					current.WriteByte('\'')
-					i += 2 // Skip both quotes
-					continue
-				}
-				inString = false
-			} else {
-				inString = true
-			}
-			current.WriteByte(b)
-		case '(':
-			if !inString {
-				depth++
-			}
-			current.WriteByte(b)
-		case ')':
-			if !inString {
-				depth--
-			}
-			current.WriteByte(b)
-		case ',':
-			if depth == 0 && !inString {
-				values = append(values, current.String())
-				current.Reset()
-			} else {
-				current.WriteByte(b)
-			}
-		default:
-			current.WriteByte(b)
+// parseLiteral reads a constant at the cursor. ok is false, and nothing is
+// consumed, if there isn't one.
+func (p *parser) parseLiteral() (literal, bool) {
+	tok := p.peek()
+	switch {
+	case (tok.is("-") || tok.is("+")) && p.peekAt(1).kind == tokenNumber:
+		p.pos += 2
+		sign := ""
+		if tok.is("-") {
+			sign = "-"
 		}
-		i++
-	}
-
-	if current.Len() > 0 {
-		values = append(values, current.String())
+		return literal{tok: p.toks[p.pos-1], sign: sign}, true
+	case tok.kind == tokenNumber, tok.kind == tokenString, tok.kind == tokenBlob, tok.kind == tokenIdent:
+		// SQLite reads a double-quoted word that names no column as a string
+		p.pos++
+		return literal{tok: tok}, true
+	case tok.is("NULL"), tok.is("TRUE"), tok.is("FALSE"):
+		p.pos++
+		return literal{tok: tok}, true
+	case tok.kind == tokenWord && p.peekAt(1).is("("):
+		start := p.pos
+		if text, ok := p.parseStringExpr(); ok {
+			return literal{tok: token{kind: tokenString, text: text, pos: tok.pos}}, true
+		}
+		p.pos = start
 	}
+	return literal{}, false
+}
 
-	return values
+// sqliteDatetimeLayouts are the zone-less forms SQLite's own date functions
+// produce, such as CURRENT_TIMESTAMP. They are in UTC.
+var sqliteDatetimeLayouts = []string{
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999",
 }
 
-func parseSQLValue(s string, colType model.ColumnType) model.Value {
-	s = strings.TrimSpace(s)
+// parseSQLiteDatetime reads an RFC 3339 timestamp, or one of the forms
+// SQLite writes itself.
+func parseSQLiteDatetime(s string) (time.Time, bool) {
+	if t, err := model.ParseDatetime(s); err == nil {
+		return t, true
+	}
+	for _, layout := range sqliteDatetimeLayouts {
+		if t, err := time.ParseInLocation(layout, s, time.UTC); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
 
-	if strings.EqualFold(s, "NULL") {
-		return model.NullValue()
+// parseStringExpr evaluates the string expressions sqlite3 .dump writes for
+// text holding control characters: unistr('a\u000ab') in recent versions,
+// replace('a\nb','\n',char(10)) in older ones. ok is false for anything
+// else, with the cursor left wherever parsing stopped.
+func (p *parser) parseStringExpr() (string, bool) {
+	tok := p.next()
+	switch {
+	case tok.kind == tokenString:
+		return tok.text, true
+	case tok.is("unistr"):
+		if !p.accept("(") {
+			return "", false
+		}
+		arg := p.next()
+		if arg.kind != tokenString || !p.accept(")") {
+			return "", false
+		}
+		return unistr(arg.text)
+	case tok.is("replace"):
+		if !p.accept("(") {
+			return "", false
+		}
+		var args [3]string
+		for i := range args {
+			if i > 0 && !p.accept(",") {
+				return "", false
+			}
+			arg, ok := p.parseStringExpr()
+			if !ok {
+				return "", false
+			}
+			args[i] = arg
+		}
+		if !p.accept(")") {
+			return "", false
+		}
+		return strings.ReplaceAll(args[0], args[1], args[2]), true
+	case tok.is("char"):
+		if !p.accept("(") {
+			return "", false
+		}
+		var b strings.Builder
+		for {
+			arg := p.next()
+			code, err := strconv.ParseInt(arg.text, 10, 32)
+			if arg.kind != tokenNumber || err != nil {
+				return "", false
+			}
+			b.WriteRune(rune(code))
+			if p.accept(")") {
+				return b.String(), true
+			}
+			if !p.accept(",") {
+				return "", false
+			}
+		}
 	}
+	return "", false
+}
 
-	// Remove surrounding quotes for strings
-	if (strings.HasPrefix(s, "'") && strings.HasSuffix(s, "'")) ||
-		(strings.HasPrefix(s, `"`) && strings.HasSuffix(s, `"`)) {
-		// Unescape SQL string
-		unquoted := s[1 : len(s)-1]
-		unquoted = strings.ReplaceAll(unquoted, "''", "'")
-		unquoted = strings.ReplaceAll(unquoted, `""`, `"`)
-		return model.TextValue(unquoted)
+// unistr decodes the escapes of SQLite's unistr(): \\ for a backslash, and
+// \XXXX, \uXXXX, \+XXXXXX or \UXXXXXXXX for a code point in hex.
+func unistr(s string) (string, bool) {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			b.WriteByte(s[i])
+			continue
+		}
+		rest := s[i+1:]
+		digits := 4
+		switch {
+		case strings.HasPrefix(rest, "\\"):
+			b.WriteByte('\\')
+			i++
+			continue
+		case strings.HasPrefix(rest, "u"):
+			rest, i = rest[1:], i+1
+		case strings.HasPrefix(rest, "+"):
+			rest, i, digits = rest[1:], i+1, 6
+		case strings.HasPrefix(rest, "U"):
+			rest, i, digits = rest[1:], i+1, 8
+		}
+		if len(rest) < digits {
+			return "", false
+		}
+		code, err := strconv.ParseUint(rest[:digits], 16, 32)
+		if err != nil {
+			return "", false
+		}
+		b.WriteRune(rune(code))
+		i += digits
 	}
+	return b.String(), true
+}
 
-	// Try parsing as number
-	if strings.Contains(s, ".") {
-		if f, err := strconv.ParseFloat(s, 64); err == nil {
-			return model.DecimalValue(f)
+// value converts the literal for a column of type colType. Integers become
+// bools in bool columns, and Unix seconds in datetime columns exported with
+// epoch storage.
+func (l literal) value(colType model.ColumnType) (model.Value, error) {
+	tok := l.tok
+	switch tok.kind {
+	case tokenBlob:
+		b, err := hex.DecodeString(tok.text)
+		if err != nil {
+			return model.Value{}, errorAt(tok.pos, "invalid blob literal X'%s'", tok.text)
+		}
+		return model.BlobValue(b), nil
+	case tokenString, tokenIdent:
+		if colType == model.ColumnTypeDatetime {
+			if t, ok := parseSQLiteDatetime(tok.text); ok {
+				return model.DatetimeValue(t), nil
+			}
+		}
+		if colType == model.ColumnTypeDecimal {
+			// Decimals are stored as text to keep them exact
+			if i, err := strconv.ParseInt(tok.text, 10, 64); err == nil {
+				return model.IntValue(i), nil
+			}
+			if d, err := model.ParseDecimal(tok.text); err == nil {
+				return model.DecimalValue(d), nil
+			}
 		}
+		return model.TextValue(tok.text), nil
+	case tokenNumber:
+		s := l.sign + tok.text
+		if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+			if colType == model.ColumnTypeBool {
+				return model.BoolValue(i != 0), nil
+			}
+			if colType == model.ColumnTypeDatetime {
+				return model.DatetimeValue(time.Unix(i, 0)), nil
+			}
+			return model.IntValue(i), nil
+		}
+		// SQL allows .5 and 1. where JSON numbers don't
+		if strings.HasPrefix(tok.text, ".") {
+			s = l.sign + "0" + tok.text
+		}
+		if strings.HasSuffix(s, ".") {
+			s += "0"
+		}
+		d, err := model.ParseDecimal(s)
+		if err != nil {
+			return model.Value{}, errorAt(tok.pos, "invalid number %s", l.sign+tok.text)
+		}
+		return model.DecimalValue(d), nil
 	}
 
-	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
-		// Check if it's a boolean (0 or 1) for INTEGER type
+	switch {
+	case tok.is("TRUE"), tok.is("FALSE"):
+		b := tok.is("TRUE")
 		if colType == model.ColumnTypeBool {
-			return model.BoolValue(i != 0)
+			return model.BoolValue(b), nil
+		}
+		if b {
+			return model.IntValue(1), nil
 		}
-		return model.IntValue(i)
+		return model.IntValue(0), nil
+	default:
+		return model.NullValue(), nil
 	}
-
-	// Default to text
-	return model.TextValue(s)
 }
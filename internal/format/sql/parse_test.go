@@ -0,0 +1,681 @@
+package sql
+
+import (
+	"bytes"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"sqlon/internal/model"
+)
+
+func TestCompositePrimaryKeyRoundtrip(t *testing.T) {
+	db := &model.Database{
+		Tables: []*model.Table{
+			{
+				Name: "settings_color_duotone_colors",
+				Columns: []model.Column{
+					{Name: "settings_color_duotone_id", Type: model.ColumnTypeInt},
+					{Name: "ordinal", Type: model.ColumnTypeInt},
+					{Name: "value", Type: model.ColumnTypeText},
+				},
+				PK: []string{"settings_color_duotone_id", "ordinal"},
+				Rows: []model.Row{
+					{model.IntValue(1), model.IntValue(1), model.TextValue("#02285b")},
+				},
+			},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := ExportSQLite(&buf, db); err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	if !strings.Contains(buf.String(), `PRIMARY KEY ("settings_color_duotone_id", "ordinal")`) {
+		t.Fatalf("expected table-level PRIMARY KEY, got:\n%s", buf.String())
+	}
+
+	parsed, err := ParseSQLite(&buf)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if got := parsed.Tables[0].PK; !reflect.DeepEqual(got, db.Tables[0].PK) {
+		t.Fatalf("expected PK %v, got %v", db.Tables[0].PK, got)
+	}
+	if got := len(parsed.Tables[0].Columns); got != 3 {
+		t.Fatalf("expected 3 columns, got %d", got)
+	}
+}
+
+func TestDecimalLiteralsRoundtripExactly(t *testing.T) {
+	literals := []string{"19.90", "1e+06", "0.1000000000000000000001", "-2.50E-3"}
+
+	table := &model.Table{
+		Name:    "prices",
+		Columns: []model.Column{{Name: "amount", Type: model.ColumnTypeDecimal}},
+	}
+	for _, lit := range literals {
+		table.Rows = append(table.Rows, model.Row{model.DecimalValue(model.Decimal(lit))})
+	}
+
+	var buf bytes.Buffer
+	if err := ExportSQLite(&buf, &model.Database{Tables: []*model.Table{table}}); err != nil {
+		t.Fatalf("export: %v", err)
+	}
+
+	parsed, err := ParseSQLite(&buf)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	for i, lit := range literals {
+		v := parsed.Tables[0].Rows[i][0]
+		if v.Kind != model.ValueKindDecimal || v.Decimal.String() != lit {
+			t.Errorf("row %d: expected decimal %s, got %s %s", i+1, lit, v.Kind, v)
+		}
+	}
+}
+
+func TestDecimalsSurviveSQLite(t *testing.T) {
+	sqlite, err := exec.LookPath("sqlite3")
+	if err != nil {
+		t.Skip("sqlite3 not installed")
+	}
+	literals := []string{"19.90", "1e+06", "0.1000000000000000000001", "-2.50E-3"}
+
+	table := &model.Table{
+		Name:    "prices",
+		Columns: []model.Column{{Name: "id", Type: model.ColumnTypeInt}, {Name: "amount", Type: model.ColumnTypeDecimal}},
+		PK:      []string{"id"},
+	}
+	for i, lit := range literals {
+		table.Rows = append(table.Rows, model.Row{model.IntValue(int64(i + 1)), model.DecimalValue(model.Decimal(lit))})
+	}
+	var script bytes.Buffer
+	if err := ExportSQLite(&script, &model.Database{Tables: []*model.Table{table}}); err != nil {
+		t.Fatalf("export: %v", err)
+	}
+
+	// Load the script and dump it back, so the values are what SQLite stored
+	path := filepath.Join(t.TempDir(), "prices.db")
+	load := exec.Command(sqlite, path)
+	load.Stdin = &script
+	if out, err := load.CombinedOutput(); err != nil {
+		t.Fatalf("load: %v\n%s", err, out)
+	}
+	dump, err := exec.Command(sqlite, path, ".dump").Output()
+	if err != nil {
+		t.Fatalf("dump: %v", err)
+	}
+
+	parsed, err := ParseSQLite(bytes.NewReader(dump))
+	if err != nil {
+		t.Fatalf("parse: %v\n%s", err, dump)
+	}
+	for i, lit := range literals {
+		v := parsed.Tables[0].Rows[i][1]
+		if v.Kind != model.ValueKindDecimal || v.Decimal.String() != lit {
+			t.Errorf("row %d: expected decimal %s, got %s %s\n%s", i+1, lit, v.Kind, v, dump)
+		}
+	}
+}
+
+func TestGeneratedKeyRoundtrip(t *testing.T) {
+	db := &model.Database{
+		Tables: []*model.Table{
+			{
+				Name:    "generated",
+				Columns: []model.Column{{Name: "id", Type: model.ColumnTypeInt, Generated: true}},
+				PK:      []string{"id"},
+			},
+			{
+				Name:    "plain",
+				Columns: []model.Column{{Name: "id", Type: model.ColumnTypeInt}},
+				PK:      []string{"id"},
+			},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := ExportSQLite(&buf, db); err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	if !strings.Contains(buf.String(), `"id" INTEGER CONSTRAINT "generated" PRIMARY KEY`) {
+		t.Errorf("expected the generated key to be marked, got:\n%s", buf.String())
+	}
+
+	parsed, err := ParseSQLite(&buf)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	for i, want := range []bool{true, false} {
+		col := parsed.Tables[i].Columns[0]
+		if col.Generated != want || !reflect.DeepEqual(parsed.Tables[i].PK, []string{"id"}) {
+			t.Errorf("table %s: expected generated=%v primary key, got %+v pk %v", parsed.Tables[i].Name, want, col, parsed.Tables[i].PK)
+		}
+	}
+}
+
+func TestBlobRoundtrip(t *testing.T) {
+	db := &model.Database{
+		Tables: []*model.Table{
+			{
+				Name:    "assets",
+				Columns: []model.Column{{Name: "icon", Type: model.ColumnTypeBlob}},
+				Rows: []model.Row{
+					{model.BlobValue([]byte{0x89, 'P', 'N', 'G'})},
+					{model.BlobValue([]byte{})},
+				},
+			},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := ExportSQLite(&buf, db); err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	if !strings.Contains(buf.String(), `X'89504E47'`) {
+		t.Fatalf("expected X'..' literal, got:\n%s", buf.String())
+	}
+
+	parsed, err := ParseSQLite(&buf)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	table := parsed.Tables[0]
+	if table.Columns[0].Type != model.ColumnTypeBlob {
+		t.Fatalf("expected blob column, got %s", table.Columns[0].Type)
+	}
+	for i, row := range db.Tables[0].Rows {
+		if got := table.Rows[i][0]; got.Key() != row[0].Key() {
+			t.Errorf("row %d: expected %s, got %s", i+1, row[0], got)
+		}
+	}
+}
+
+func TestEnumRecoveredFromCheckConstraint(t *testing.T) {
+	input := `CREATE TABLE "templates" (
+    "kind" TEXT NOT NULL CONSTRAINT "layout" CHECK ("kind" IN ('default', 'it''s')),
+    "alt" TEXT CONSTRAINT "layout" CHECK ("alt" IN ('default', 'it''s')),
+    "size" TEXT CHECK("size" IN ('s', 'm'))
+);`
+
+	db, err := ParseSQLite(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+
+	want := []model.Enum{
+		{Name: "layout", Values: []string{"default", "it's"}},
+		{Name: "templates_size", Values: []string{"s", "m"}},
+	}
+	if !reflect.DeepEqual(db.Enums, want) {
+		t.Fatalf("expected enums %v, got %v", want, db.Enums)
+	}
+
+	cols := db.Tables[0].Columns
+	for i, enum := range []string{"layout", "layout", "templates_size"} {
+		if cols[i].Type != model.ColumnTypeEnum || cols[i].Enum != enum {
+			t.Errorf("column %s: expected enum %s, got %s/%s", cols[i].Name, enum, cols[i].Type, cols[i].Enum)
+		}
+	}
+}
+
+func TestForeignKeysExportedParentFirst(t *testing.T) {
+	db := &model.Database{
+		Tables: []*model.Table{
+			{
+				Name: "posts",
+				Columns: []model.Column{
+					{Name: "id", Type: model.ColumnTypeInt},
+					{Name: "author_id", Type: model.ColumnTypeInt},
+				},
+				PK:          []string{"id"},
+				Rows:        []model.Row{{model.IntValue(10), model.IntValue(1)}},
+				ForeignKeys: []model.ForeignKey{{Name: "author_id", ReferencedTable: "people", ReferencedColumn: "id"}},
+			},
+			{
+				Name:    "people",
+				Columns: []model.Column{{Name: "id", Type: model.ColumnTypeInt}},
+				PK:      []string{"id"},
+				Rows:    []model.Row{{model.IntValue(1)}},
+			},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := ExportSQLiteWithOptions(&buf, db, ExportOptions{OnDeleteCascade: true}); err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	out := buf.String()
+	if !strings.HasPrefix(out, "PRAGMA foreign_keys=ON;") {
+		t.Fatalf("expected foreign_keys pragma first, got:\n%s", out)
+	}
+	if !strings.Contains(out, `FOREIGN KEY ("author_id") REFERENCES "people" ("id") ON DELETE CASCADE`) {
+		t.Fatalf("expected FOREIGN KEY constraint, got:\n%s", out)
+	}
+	if strings.Index(out, `CREATE TABLE "people"`) > strings.Index(out, `CREATE TABLE "posts"`) {
+		t.Fatalf("expected parent table before child, got:\n%s", out)
+	}
+
+	parsed, err := ParseSQLite(&buf)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	posts, ok := parsed.TableByName("posts")
+	if !ok {
+		t.Fatalf("posts table missing after parse")
+	}
+	if !reflect.DeepEqual(posts.ForeignKeys, db.Tables[0].ForeignKeys) {
+		t.Fatalf("expected foreign keys %v, got %v", db.Tables[0].ForeignKeys, posts.ForeignKeys)
+	}
+	if got := len(posts.Columns); got != 2 {
+		t.Fatalf("expected 2 columns, got %d", got)
+	}
+}
+
+func TestParseCommentsAndQuotedNames(t *testing.T) {
+	input := `-- fixture; edited by hand, don't regenerate
+/* a block comment with 'quotes'; and semicolons */
+CREATE TABLE "order items" (
+    [item id] INTEGER PRIMARY KEY, -- the key; really
+    ` + "`unit price`" + ` REAL,
+    note TEXT /* trailing ; comment */
+);
+INSERT INTO "order items" VALUES (1, -2.5, 'a -- not a comment; ''quoted''');`
+
+	db, err := ParseSQLite(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+
+	table := db.Tables[0]
+	if table.Name != "order items" {
+		t.Fatalf("expected table %q, got %q", "order items", table.Name)
+	}
+	if got := table.ColumnNames(); !reflect.DeepEqual(got, []string{"item id", "unit price", "note"}) {
+		t.Fatalf("unexpected columns %v", got)
+	}
+	if !reflect.DeepEqual(table.PK, []string{"item id"}) {
+		t.Fatalf("expected PK [item id], got %v", table.PK)
+	}
+	want := model.Row{model.IntValue(1), model.DecimalValue("-2.5"), model.TextValue("a -- not a comment; 'quoted'")}
+	if len(table.Rows) != 1 || model.RowKey(table.Rows[0], []int{0, 1, 2}) != model.RowKey(want, []int{0, 1, 2}) {
+		t.Fatalf("expected row %v, got %v", want, table.Rows)
+	}
+}
+
+func TestParseErrorsReportPosition(t *testing.T) {
+	cases := map[string]string{
+		"CREATE TABLE t (a INTEGER);\nINSERT INTO t VALUES (1 2);": "line 2:25:",
+		"CREATE TABLE t (\n  a TEXT DEFAULT 'oops\n);":             "line 2:18: unterminated",
+		"/* never closed": "line 1:1: unterminated",
+	}
+	for input, want := range cases {
+		_, err := ParseSQLite(strings.NewReader(input))
+		if err == nil || !strings.HasPrefix(err.Error(), want) {
+			t.Errorf("parse %q: expected error starting %q, got %v", input, want, err)
+		}
+	}
+}
+
+func TestInsertTargetsNamedTableAndColumns(t *testing.T) {
+	input := `CREATE TABLE people (id INTEGER PRIMARY KEY, name TEXT, active INTEGER DEFAULT 1);
+CREATE TABLE posts (id INTEGER PRIMARY KEY, title TEXT);
+INSERT INTO people (name, id) VALUES ('Ada', 1);
+INSERT INTO posts (title, id) VALUES ('Hello', 10);
+INSERT INTO people VALUES (2, 'Grace', 0);`
+
+	db, err := ParseSQLite(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+
+	people, _ := db.TableByName("people")
+	want := []model.Row{
+		{model.IntValue(1), model.TextValue("Ada"), model.IntValue(1)},
+		{model.IntValue(2), model.TextValue("Grace"), model.IntValue(0)},
+	}
+	if len(people.Rows) != len(want) {
+		t.Fatalf("expected %d people, got %d", len(want), len(people.Rows))
+	}
+	for i, row := range want {
+		if got := people.Rows[i]; model.RowKey(got, []int{0, 1, 2}) != model.RowKey(row, []int{0, 1, 2}) {
+			t.Errorf("people row %d: expected %v, got %v", i+1, row, got)
+		}
+	}
+
+	posts, _ := db.TableByName("posts")
+	if len(posts.Rows) != 1 || posts.Rows[0][0].Int64 != 10 || posts.Rows[0][1].Text != "Hello" {
+		t.Fatalf("expected posts row (10, Hello), got %v", posts.Rows)
+	}
+}
+
+func TestInsertRejectsUnknownTableOrColumn(t *testing.T) {
+	cases := map[string]string{
+		"CREATE TABLE t (a INTEGER);\nINSERT INTO u VALUES (1);":           `line 2:13: INSERT INTO unknown table "u"`,
+		"CREATE TABLE t (a INTEGER);\nINSERT INTO t (a, b) VALUES (1, 2);": `line 2:19: table "t" has no column "b"`,
+		"CREATE TABLE t (a INTEGER);\nINSERT INTO t VALUES (1, 2);":        `line 2:22: 2 values for 1 columns`,
+	}
+	for input, want := range cases {
+		_, err := ParseSQLite(strings.NewReader(input))
+		if err == nil || !strings.HasPrefix(err.Error(), want) {
+			t.Errorf("parse %q: expected error starting %q, got %v", input, want, err)
+		}
+	}
+}
+
+func TestBatchedInsertsRoundtrip(t *testing.T) {
+	table := &model.Table{
+		Name:    "numbers",
+		Columns: []model.Column{{Name: "n", Type: model.ColumnTypeInt}},
+	}
+	for i := 0; i < 5; i++ {
+		table.Rows = append(table.Rows, model.Row{model.IntValue(int64(i))})
+	}
+
+	var buf bytes.Buffer
+	if err := ExportSQLiteWithOptions(&buf, &model.Database{Tables: []*model.Table{table}}, ExportOptions{BatchSize: 2}); err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	out := buf.String()
+	if got := strings.Count(out, "INSERT INTO"); got != 3 {
+		t.Fatalf("expected 3 INSERT statements for 5 rows in batches of 2, got %d:\n%s", got, out)
+	}
+	if !strings.Contains(out, "BEGIN;") || !strings.HasSuffix(out, "COMMIT;\n") {
+		t.Fatalf("expected batched export in a transaction, got:\n%s", out)
+	}
+
+	parsed, err := ParseSQLite(&buf)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	rows := parsed.Tables[0].Rows
+	if len(rows) != 5 {
+		t.Fatalf("expected 5 rows, got %d", len(rows))
+	}
+	for i, row := range rows {
+		if row[0].Int64 != int64(i) {
+			t.Errorf("row %d: expected %d, got %s", i+1, i, row[0])
+		}
+	}
+}
+
+func TestParseSQLiteDump(t *testing.T) {
+	// Output of sqlite3 .dump, plus the replace()/char() form older
+	// versions use for control characters. The FTS5 and R*Tree tables
+	// are declared through sqlite_schema, with their shadow tables'
+	// names quoted as strings.
+	input := `PRAGMA foreign_keys=OFF;
+BEGIN TRANSACTION;
+PRAGMA writable_schema=ON;
+INSERT INTO sqlite_schema(type,name,tbl_name,rootpage,sql)VALUES('table','ft','ft',0,'CREATE VIRTUAL TABLE ft USING fts5(body)');
+CREATE TABLE IF NOT EXISTS 'ft_data'(id INTEGER PRIMARY KEY, block BLOB);
+INSERT INTO ft_data VALUES(1,X'0101');
+CREATE TABLE IF NOT EXISTS 'ft_idx'(segid, term, pgno, PRIMARY KEY(segid, term)) WITHOUT ROWID;
+INSERT INTO ft_idx VALUES(1,X'',2);
+CREATE TABLE IF NOT EXISTS 'ft_content'(id INTEGER PRIMARY KEY, c0);
+INSERT INTO ft_content VALUES(1,'hello');
+CREATE TABLE IF NOT EXISTS 'ft_docsize'(id INTEGER PRIMARY KEY, sz BLOB);
+INSERT INTO ft_docsize VALUES(1,X'01');
+CREATE TABLE IF NOT EXISTS 'ft_config'(k PRIMARY KEY, v) WITHOUT ROWID;
+INSERT INTO ft_config VALUES('version',4);
+INSERT INTO sqlite_schema(type,name,tbl_name,rootpage,sql)VALUES('table','rt','rt',0,'CREATE VIRTUAL TABLE rt USING rtree(id, x0, x1)');
+CREATE TABLE IF NOT EXISTS "rt_rowid"(rowid INTEGER PRIMARY KEY,nodeno);
+INSERT INTO rt_rowid VALUES(1,1);
+CREATE TABLE IF NOT EXISTS "rt_node"(nodeno INTEGER PRIMARY KEY,data);
+INSERT INTO rt_node VALUES(1,X'00000001');
+CREATE TABLE IF NOT EXISTS "rt_parent"(nodeno INTEGER PRIMARY KEY,parentnode);
+PRAGMA writable_schema=OFF;
+CREATE TABLE people(id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT NOT NULL, bio TEXT, avatar BLOB, score REAL);
+INSERT INTO people VALUES(1,'Ada',unistr('line1\u000aline2\u0009tab'),X'00ff',1.5);
+INSERT INTO people VALUES(2,'O''Brien',replace('a\nb','\n',char(10)),NULL,2.0e+20);
+CREATE TABLE posts(id INTEGER PRIMARY KEY, author_id INTEGER REFERENCES people(id), title TEXT);
+INSERT INTO posts VALUES(1,1,'hi');
+ANALYZE sqlite_schema;
+INSERT INTO sqlite_stat1 VALUES('posts','posts_author','2 1');
+DELETE FROM sqlite_sequence;
+INSERT INTO sqlite_sequence VALUES('people',2);
+CREATE VIEW v AS SELECT name FROM people;
+CREATE TRIGGER tr AFTER INSERT ON people BEGIN UPDATE people SET bio = CASE WHEN NEW.bio IS NULL THEN 'x;y' ELSE NEW.bio END WHERE id = NEW.id; INSERT INTO posts(author_id, title) VALUES (NEW.id, 'hi'); END;
+CREATE INDEX posts_author ON posts(author_id);
+COMMIT;`
+
+	db, err := ParseSQLite(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if len(db.Tables) != 2 {
+		var names []string
+		for _, table := range db.Tables {
+			names = append(names, table.Name)
+		}
+		t.Fatalf("expected tables people and posts, got %v", names)
+	}
+
+	people, _ := db.TableByName("people")
+	if len(people.Rows) != 2 {
+		t.Fatalf("expected 2 people, got %d", len(people.Rows))
+	}
+	if got := people.Rows[0][2].Text; got != "line1\nline2\ttab" {
+		t.Errorf("expected unistr() text decoded, got %q", got)
+	}
+	if got := people.Rows[1][2].Text; got != "a\nb" {
+		t.Errorf("expected replace() text decoded, got %q", got)
+	}
+	if got := people.Rows[0][3]; got.Kind != model.ValueKindBlob || len(got.Bytes) != 2 {
+		t.Errorf("expected 2-byte blob, got %s", got)
+	}
+
+	posts, _ := db.TableByName("posts")
+	if len(posts.Rows) != 1 {
+		t.Fatalf("expected the trigger's INSERT to be skipped, got %d posts", len(posts.Rows))
+	}
+	if len(posts.Indexes) != 1 || posts.Indexes[0].Name != "posts_author" {
+		t.Fatalf("expected index posts_author, got %v", posts.Indexes)
+	}
+}
+
+func TestColumnTypesRoundtrip(t *testing.T) {
+	when := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+	db := &model.Database{
+		Tables: []*model.Table{
+			{
+				Name: "events",
+				Columns: []model.Column{
+					{Name: "id", Type: model.ColumnTypeInt},
+					{Name: "done", Type: model.ColumnTypeBool},
+					{Name: "at", Type: model.ColumnTypeDatetime},
+					{Name: "nothing", Type: model.ColumnTypeNull},
+					{Name: "price", Type: model.ColumnTypeDecimal},
+				},
+				PK: []string{"id"},
+				Rows: []model.Row{
+					{model.IntValue(1), model.BoolValue(true), model.DatetimeValue(when), model.NullValue(), model.DecimalValue("2.50")},
+				},
+			},
+		},
+	}
+
+	for _, storage := range []DatetimeStorage{DatetimeISO, DatetimeEpoch} {
+		var buf bytes.Buffer
+		if err := ExportSQLiteWithOptions(&buf, db, ExportOptions{Datetime: storage}); err != nil {
+			t.Fatalf("export: %v", err)
+		}
+
+		parsed, err := ParseSQLite(&buf)
+		if err != nil {
+			t.Fatalf("parse: %v", err)
+		}
+		table := parsed.Tables[0]
+		if !reflect.DeepEqual(table.Columns, db.Tables[0].Columns) {
+			t.Errorf("storage %d: expected columns %v, got %v", storage, db.Tables[0].Columns, table.Columns)
+		}
+		idx := []int{0, 1, 2, 3, 4}
+		if model.RowKey(table.Rows[0], idx) != model.RowKey(db.Tables[0].Rows[0], idx) {
+			t.Errorf("storage %d: expected row %v, got %v", storage, db.Tables[0].Rows[0], table.Rows[0])
+		}
+	}
+}
+
+func TestParseDeclaredTypesAndSQLiteTimestamps(t *testing.T) {
+	input := `CREATE TABLE t (
+    a BIGINT, b VARCHAR(20), c DOUBLE PRECISION, d BOOL,
+    e DATETIME DEFAULT '2024-01-02 03:04:05', f TIMESTAMP
+);
+INSERT INTO t (a, b, c, d, f) VALUES (1, 'x', 1.5, 1, 'not a timestamp');`
+
+	db, err := ParseSQLite(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+
+	table := db.Tables[0]
+	want := []model.ColumnType{
+		model.ColumnTypeInt, model.ColumnTypeText, model.ColumnTypeDecimal, model.ColumnTypeBool,
+		model.ColumnTypeDatetime, model.ColumnTypeText,
+	}
+	for i, typ := range want {
+		if got := table.Columns[i].Type; got != typ {
+			t.Errorf("column %s: expected %s, got %s", table.Columns[i].Name, typ, got)
+		}
+	}
+	if got := table.Rows[0][4]; got.Kind != model.ValueKindDatetime || !got.Time.Equal(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)) {
+		t.Errorf("expected default timestamp in UTC, got %s", got)
+	}
+}
+
+func TestParseCreateTableConstraints(t *testing.T) {
+	input := `CREATE TABLE authors (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    email TEXT NOT NULL ON CONFLICT ABORT UNIQUE COLLATE NOCASE,
+    karma INTEGER DEFAULT -1 CHECK (karma >= -1),
+    bio TEXT NULL
+);
+CREATE TABLE posts (
+    id INTEGER NOT NULL,
+    author_id INTEGER REFERENCES authors ON DELETE SET DEFAULT DEFERRABLE INITIALLY DEFERRED,
+    editor_id INTEGER CONSTRAINT fk_editor REFERENCES authors (id) ON UPDATE NO ACTION,
+    slug TEXT DEFAULT ('draft'),
+    lang TEXT,
+    CONSTRAINT pk_posts PRIMARY KEY (id),
+    UNIQUE (slug, lang),
+    UNIQUE (lang),
+    CHECK (length(slug) > 0),
+    FOREIGN KEY (editor_id) REFERENCES authors (id) MATCH SIMPLE
+);`
+
+	db, err := ParseSQLite(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+
+	authors, _ := db.TableByName("authors")
+	karma := model.IntValue(-1)
+	wantAuthors := []model.Column{
+		{Name: "id", Type: model.ColumnTypeInt},
+		{Name: "email", Type: model.ColumnTypeText, NotNull: true, Unique: true},
+		{Name: "karma", Type: model.ColumnTypeInt, Default: &karma},
+		{Name: "bio", Type: model.ColumnTypeText},
+	}
+	if !reflect.DeepEqual(authors.Columns, wantAuthors) {
+		t.Errorf("expected authors columns %v, got %v", wantAuthors, authors.Columns)
+	}
+
+	posts, _ := db.TableByName("posts")
+	if !reflect.DeepEqual(posts.PK, []string{"id"}) {
+		t.Errorf("expected posts PK [id], got %v", posts.PK)
+	}
+	if c := posts.Columns[0]; !c.NotNull {
+		t.Errorf("expected posts.id NOT NULL")
+	}
+	if d := posts.Columns[3].Default; d == nil || d.Text != "draft" {
+		t.Errorf("expected slug default 'draft', got %v", d)
+	}
+	if !posts.Columns[4].Unique {
+		t.Errorf("expected lang to be unique")
+	}
+	wantIndexes := []model.Index{{Name: "posts_slug_lang_key", Columns: []string{"slug", "lang"}, Unique: true}}
+	if !reflect.DeepEqual(posts.Indexes, wantIndexes) {
+		t.Errorf("expected indexes %v, got %v", wantIndexes, posts.Indexes)
+	}
+	wantFKs := []model.ForeignKey{
+		{Name: "author_id", ReferencedTable: "authors", ReferencedColumn: "id"},
+		{Name: "editor_id", ReferencedTable: "authors", ReferencedColumn: "id"},
+	}
+	if !reflect.DeepEqual(posts.ForeignKeys, wantFKs) {
+		t.Errorf("expected foreign keys %v, got %v", wantFKs, posts.ForeignKeys)
+	}
+}
+
+func TestUpsertExport(t *testing.T) {
+	db := &model.Database{
+		Tables: []*model.Table{
+			{
+				Name: "people",
+				Columns: []model.Column{
+					{Name: "id", Type: model.ColumnTypeInt},
+					{Name: "name", Type: model.ColumnTypeText},
+				},
+				PK:      []string{"id"},
+				Rows:    []model.Row{{model.IntValue(1), model.TextValue("Ada")}},
+				Indexes: []model.Index{{Name: "by_name", Columns: []string{"name"}}},
+			},
+			{
+				Name:    "tags",
+				Columns: []model.Column{{Name: "label", Type: model.ColumnTypeText}},
+				Rows:    []model.Row{{model.TextValue("x")}},
+			},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := ExportSQLiteWithOptions(&buf, db, ExportOptions{Upsert: true}); err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		`CREATE TABLE IF NOT EXISTS "people" (`,
+		`VALUES (1, 'Ada') ON CONFLICT ("id") DO UPDATE SET "name" = excluded."name";`,
+		`CREATE INDEX IF NOT EXISTS "by_name" ON "people" ("name");`,
+		"DELETE FROM \"tags\";\nINSERT INTO \"tags\"",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected output to contain %s, got:\n%s", want, out)
+		}
+	}
+
+	parsed, err := ParseSQLite(&buf)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if got := len(parsed.Tables[0].Rows) + len(parsed.Tables[1].Rows); got != 2 {
+		t.Fatalf("expected 2 rows after parsing upsert export, got %d", got)
+	}
+
+	if err := Export(&buf, db, ExportOptions{Dialect: DialectMySQL, Upsert: true}); err == nil {
+		t.Fatalf("expected upsert export to be rejected for mysql")
+	}
+}
+
+func TestParseVirtualTableSchema(t *testing.T) {
+	// A hand-written script creates the virtual table directly and fills
+	// it, and names a table with a string as SQLite allows
+	input := `CREATE VIRTUAL TABLE IF NOT EXISTS docs USING fts4(body);
+INSERT INTO docs(body) VALUES ('hello');
+CREATE TABLE 'docs_notes'(id INTEGER PRIMARY KEY, note TEXT);
+INSERT INTO 'docs_notes' VALUES (1, 'kept');`
+
+	db, err := ParseSQLite(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if len(db.Tables) != 1 || db.Tables[0].Name != "docs_notes" {
+		t.Fatalf("expected only table docs_notes, got %d tables", len(db.Tables))
+	}
+	if len(db.Tables[0].Rows) != 1 {
+		t.Errorf("expected 1 row, got %d", len(db.Tables[0].Rows))
+	}
+}
@@ -0,0 +1,162 @@
+package sql
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"sqlon/internal/model"
+)
+
+// postgresDialect writes PostgreSQL. Every table lives in schema, enums
+// become native enum types and a single-column integer primary key becomes
+// an identity column.
+type postgresDialect struct {
+	schema string
+	upsert bool
+}
+
+func (d postgresDialect) preamble(w io.Writer, db *model.Database) error {
+	if d.schema != "public" {
+		if _, err := fmt.Fprintf(w, "CREATE SCHEMA IF NOT EXISTS %s;\n\n", quoteIdent(d.schema)); err != nil {
+			return err
+		}
+	}
+
+	for _, e := range db.Enums {
+		values := make([]string, 0, len(e.Values))
+		for _, v := range e.Values {
+			values = append(values, d.literal(model.TextValue(v)))
+		}
+		create := fmt.Sprintf("CREATE TYPE %s AS ENUM (%s);", d.tableName(e.Name), strings.Join(values, ", "))
+		if d.upsert {
+			// CREATE TYPE has no IF NOT EXISTS
+			create = "DO $$ BEGIN " + create + " EXCEPTION WHEN duplicate_object THEN NULL; END $$;"
+		}
+		if _, err := io.WriteString(w, create+"\n"); err != nil {
+			return err
+		}
+	}
+	if len(db.Enums) > 0 {
+		if _, err := io.WriteString(w, "\n"); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (d postgresDialect) quoteIdent(name string) string {
+	return quoteIdent(name)
+}
+
+// tableName qualifies name with the schema. Enum types share the namespace
+// and are qualified the same way.
+func (d postgresDialect) tableName(name string) string {
+	return quoteIdent(d.schema) + "." + quoteIdent(name)
+}
+
+func (d postgresDialect) columnType(t *model.Table, c model.Column) string {
+	switch c.Type {
+	case model.ColumnTypeInt:
+		if identityColumn(t, c) {
+			return "BIGINT GENERATED BY DEFAULT AS IDENTITY"
+		}
+		return "BIGINT"
+	case model.ColumnTypeText:
+		return "TEXT"
+	case model.ColumnTypeBool:
+		return "BOOLEAN"
+	case model.ColumnTypeDecimal:
+		return "NUMERIC"
+	case model.ColumnTypeDatetime:
+		return "TIMESTAMPTZ"
+	case model.ColumnTypeNull:
+		return "TEXT"
+	case model.ColumnTypeBlob:
+		return "BYTEA"
+	case model.ColumnTypeEnum:
+		return d.tableName(c.Enum)
+	default:
+		return "TEXT"
+	}
+}
+
+// identityColumn reports whether c is the table's sole, integer, primary key
+// column, which Postgres generates values for.
+func identityColumn(t *model.Table, c model.Column) bool {
+	return c.Type == model.ColumnTypeInt && len(t.PK) == 1 && t.PK[0] == c.Name
+}
+
+// enumConstraint returns nothing: enum columns use the native enum type
+// created in the preamble.
+func (d postgresDialect) enumConstraint(c model.Column, e *model.Enum) string {
+	return ""
+}
+
+func (d postgresDialect) literal(v model.Value) string {
+	switch v.Kind {
+	case model.ValueKindNull:
+		return "NULL"
+	case model.ValueKindInt:
+		return fmt.Sprintf("%d", v.Int64)
+	case model.ValueKindDecimal:
+		return v.Decimal.String()
+	case model.ValueKindBool:
+		if v.Bool {
+			return "TRUE"
+		}
+		return "FALSE"
+	case model.ValueKindText:
+		return postgresString(v.Text)
+	case model.ValueKindDatetime:
+		return "'" + model.FormatDatetime(v.Time) + "'"
+	case model.ValueKindBlob:
+		return fmt.Sprintf(`E'\\x%x'`, v.Bytes)
+	default:
+		return "NULL"
+	}
+}
+
+// postgresString renders s as an escape string constant (E'...'), which
+// reads the same whatever standard_conforming_strings is set to.
+func postgresString(s string) string {
+	var b strings.Builder
+	b.WriteString("E'")
+	for _, r := range s {
+		switch r {
+		case '\\':
+			b.WriteString(`\\`)
+		case '\'':
+			b.WriteString(`''`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	b.WriteString("'")
+	return b.String()
+}
+
+func (d postgresDialect) tableOptions() string {
+	return ""
+}
+
+// afterInserts moves an identity column's sequence past the explicit keys
+// just inserted, so that later inserts without a key don't collide.
+func (d postgresDialect) afterInserts(w io.Writer, t *model.Table) error {
+	for _, c := range t.Columns {
+		if !identityColumn(t, c) {
+			continue
+		}
+		_, err := fmt.Fprintf(w, "SELECT setval(pg_get_serial_sequence(%s, %s), (SELECT MAX(%s) FROM %s));\n",
+			postgresString(d.tableName(t.Name)), postgresString(c.Name), quoteIdent(c.Name), d.tableName(t.Name))
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package sql
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"sqlon/internal/model"
+)
+
+func TestPostgresExport(t *testing.T) {
+	db := &model.Database{
+		Enums: []model.Enum{{Name: "status", Values: []string{"draft", "live"}}},
+		Tables: []*model.Table{
+			{
+				Name: "posts",
+				Columns: []model.Column{
+					{Name: "id", Type: model.ColumnTypeInt},
+					{Name: "title", Type: model.ColumnTypeText},
+					{Name: "published", Type: model.ColumnTypeBool},
+					{Name: "price", Type: model.ColumnTypeDecimal},
+					{Name: "status", Type: model.ColumnTypeEnum, Enum: "status"},
+				},
+				PK: []string{"id"},
+				Rows: []model.Row{
+					{model.IntValue(7), model.TextValue(`it's a \ path`), model.BoolValue(true), model.DecimalValue("19.90"), model.TextValue("live")},
+				},
+			},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := Export(&buf, db, ExportOptions{Dialect: DialectPostgres, Schema: "app"}); err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	out := buf.String()
+
+	for _, want := range []string{
+		`CREATE SCHEMA IF NOT EXISTS "app";`,
+		`CREATE TYPE "app"."status" AS ENUM (E'draft', E'live');`,
+		`CREATE TABLE "app"."posts" (`,
+		`"id" BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY`,
+		`"published" BOOLEAN`,
+		`"price" NUMERIC`,
+		`"status" "app"."status"`,
+		`VALUES (7, E'it''s a \\ path', TRUE, 19.90, E'live');`,
+		`SELECT setval(pg_get_serial_sequence(E'"app"."posts"', E'id'), (SELECT MAX("id") FROM "app"."posts"));`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected output to contain %s, got:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "PRAGMA") {
+		t.Errorf("unexpected SQLite pragma in Postgres output:\n%s", out)
+	}
+}
@@ -2,6 +2,7 @@ package sqlon
 
 import (
 	"bufio"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
@@ -17,6 +18,7 @@ func Parse(r io.Reader) (*model.Database, error) {
 
 	var current *model.Table
 	lineNo := 0
+	declaredFKs := false
 
 	for scanner.Scan() {
 		lineNo++
@@ -43,13 +45,26 @@ func Parse(r io.Reader) (*model.Database, error) {
 				continue
 			}
 
+			// Enums belong to the database, not a table, so may appear anywhere
+			if strings.HasPrefix(line, "@enum") {
+				e, err := parseEnum(strings.TrimSpace(strings.TrimPrefix(line, "@enum")))
+				if err != nil {
+					return nil, fmt.Errorf("line %d: %w", lineNo, err)
+				}
+				if _, exists := db.EnumByName(e.Name); exists {
+					return nil, fmt.Errorf("line %d: enum %q is already declared", lineNo, e.Name)
+				}
+				db.Enums = append(db.Enums, e)
+				continue
+			}
+
 			if current == nil {
 				return nil, fmt.Errorf("line %d: directive %q appears before @table", lineNo, line)
 			}
 
 			if strings.HasPrefix(line, "@cols") {
 				spec := strings.TrimSpace(strings.TrimPrefix(line, "@cols"))
-				cols, err := parseCols(spec)
+				cols, err := parseCols(spec, db)
 				if err != nil {
 					return nil, fmt.Errorf("line %d: %w", lineNo, err)
 				}
@@ -58,14 +73,33 @@ func Parse(r io.Reader) (*model.Database, error) {
 			}
 
 			if strings.HasPrefix(line, "@pk") {
-				pk := strings.TrimSpace(strings.TrimPrefix(line, "@pk"))
-				if pk == "" {
-					return nil, fmt.Errorf("line %d: @pk requires a column name", lineNo)
+				pk, err := parsePK(strings.TrimSpace(strings.TrimPrefix(line, "@pk")))
+				if err != nil {
+					return nil, fmt.Errorf("line %d: %w", lineNo, err)
 				}
 				current.PK = pk
 				continue
 			}
 
+			if strings.HasPrefix(line, "@index") {
+				idx, err := parseIndex(strings.TrimSpace(strings.TrimPrefix(line, "@index")))
+				if err != nil {
+					return nil, fmt.Errorf("line %d: %w", lineNo, err)
+				}
+				current.Indexes = append(current.Indexes, idx)
+				continue
+			}
+
+			if strings.HasPrefix(line, "@fk") {
+				fk, err := parseFK(strings.TrimSpace(strings.TrimPrefix(line, "@fk")))
+				if err != nil {
+					return nil, fmt.Errorf("line %d: %w", lineNo, err)
+				}
+				current.ForeignKeys = append(current.ForeignKeys, fk)
+				declaredFKs = true
+				continue
+			}
+
 			return nil, fmt.Errorf("line %d: unknown directive %q", lineNo, line)
 		}
 
@@ -80,6 +114,9 @@ func Parse(r io.Reader) (*model.Database, error) {
 		if err != nil {
 			return nil, fmt.Errorf("line %d: %w", lineNo, err)
 		}
+		if err := checkEnumValues(db, current, row); err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNo, err)
+		}
 		current.Rows = append(current.Rows, row)
 	}
 
@@ -87,8 +124,11 @@ func Parse(r io.Reader) (*model.Database, error) {
 		return nil, err
 	}
 
-	// Infer foreign keys from column names (e.g., "parentTable_id" -> FK to "parentTable")
-	inferForeignKeys(db)
+	// Infer foreign keys from column names (e.g., "parentTable_id" -> FK to "parentTable"),
+	// but only for files that predate @fk; explicit declarations always win.
+	if !declaredFKs {
+		inferForeignKeys(db)
+	}
 
 	return db, nil
 }
@@ -119,12 +159,150 @@ func inferForeignKeys(db *model.Database) {
 	}
 }
 
-func parseCols(spec string) ([]model.Column, error) {
+// parseEnum parses the body of an @enum directive: "name = a|b|c".
+func parseEnum(spec string) (model.Enum, error) {
+	parts := strings.SplitN(spec, "=", 2)
+	if len(parts) != 2 {
+		return model.Enum{}, fmt.Errorf("invalid @enum %q (expected name = a|b|c)", spec)
+	}
+
+	name := strings.TrimSpace(parts[0])
+	if name == "" || strings.ContainsAny(name, " \t,:!=") {
+		return model.Enum{}, fmt.Errorf("invalid enum name %q", name)
+	}
+	if model.ColumnType(name).Valid() || model.ColumnType(name) == model.ColumnTypeEnum {
+		return model.Enum{}, fmt.Errorf("enum name %q clashes with a built-in type", name)
+	}
+
+	e := model.Enum{Name: name}
+	for _, v := range strings.Split(parts[1], "|") {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			return model.Enum{}, fmt.Errorf("enum %q has an empty value", name)
+		}
+		if e.Has(v) {
+			return model.Enum{}, fmt.Errorf("enum %q repeats value %q", name, v)
+		}
+		e.Values = append(e.Values, v)
+	}
+
+	return e, nil
+}
+
+// checkEnumValues rejects rows whose enum columns hold a value outside the
+// enum. Other type mismatches are left to Database.Validate.
+func checkEnumValues(db *model.Database, t *model.Table, row model.Row) error {
+	for i, c := range t.Columns {
+		if c.Type != model.ColumnTypeEnum || i >= len(row) || row[i].Kind != model.ValueKindText {
+			continue
+		}
+		e, _ := db.EnumByName(c.Enum)
+		if !e.Has(row[i].Text) {
+			return fmt.Errorf("value %s for column %q is not in enum %q", row[i], c.Name, e.Name)
+		}
+	}
+	return nil
+}
+
+// parsePK parses the body of a @pk directive: one column name, or several
+// separated by commas for a composite key.
+func parsePK(spec string) ([]string, error) {
 	if spec == "" {
-		return nil, errors.New("@cols requires a list like name:type,name:type")
+		return nil, errors.New("@pk requires a column name")
 	}
 
 	parts := splitByCommaRespectingWhitespace(spec)
+	seen := make(map[string]bool, len(parts))
+	pk := make([]string, 0, len(parts))
+	for _, p := range parts {
+		if p == "" {
+			return nil, fmt.Errorf("invalid @pk %q (empty column name)", spec)
+		}
+		if seen[p] {
+			return nil, fmt.Errorf("invalid @pk %q (column %q repeated)", spec, p)
+		}
+		seen[p] = true
+		pk = append(pk, p)
+	}
+
+	return pk, nil
+}
+
+// parseIndex parses the body of an @index directive: "[unique] name (col, ...)".
+func parseIndex(spec string) (model.Index, error) {
+	var idx model.Index
+
+	if rest := strings.TrimPrefix(spec, "unique "); rest != spec {
+		idx.Unique = true
+		spec = strings.TrimSpace(rest)
+	}
+
+	// A quoted name may hold spaces and parentheses
+	nameEnd := 0
+	if strings.HasPrefix(spec, `"`) {
+		quoted, err := strconv.QuotedPrefix(spec)
+		if err != nil {
+			return model.Index{}, fmt.Errorf("invalid index name in @index %q", spec)
+		}
+		nameEnd = len(quoted)
+	}
+
+	open := nameEnd + strings.Index(spec[nameEnd:], "(")
+	if open < nameEnd || open == 0 || !strings.HasSuffix(spec, ")") {
+		return model.Index{}, fmt.Errorf("invalid @index %q (expected [unique] name (col, ...))", spec)
+	}
+
+	idx.Name = strings.TrimSpace(spec[:open])
+	if nameEnd > 0 {
+		if strings.TrimSpace(spec[nameEnd:open]) != "" {
+			return model.Index{}, fmt.Errorf("invalid @index %q (expected [unique] name (col, ...))", spec)
+		}
+		idx.Name, _ = strconv.Unquote(spec[:nameEnd])
+	} else if strings.ContainsAny(idx.Name, " \t") {
+		return model.Index{}, fmt.Errorf("invalid index name %q", idx.Name)
+	}
+
+	for _, col := range splitByCommaRespectingWhitespace(spec[open+1 : len(spec)-1]) {
+		if col == "" {
+			return model.Index{}, fmt.Errorf("invalid @index %q (empty column name)", spec)
+		}
+		idx.Columns = append(idx.Columns, col)
+	}
+
+	return idx, nil
+}
+
+// parseFK parses the body of an @fk directive: "column -> table.column".
+func parseFK(spec string) (model.ForeignKey, error) {
+	parts := strings.SplitN(spec, "->", 2)
+	if len(parts) != 2 {
+		return model.ForeignKey{}, fmt.Errorf("invalid @fk %q (expected column -> table.column)", spec)
+	}
+
+	col := strings.TrimSpace(parts[0])
+	ref := strings.TrimSpace(parts[1])
+	dot := strings.LastIndex(ref, ".")
+	if col == "" || dot <= 0 || dot == len(ref)-1 {
+		return model.ForeignKey{}, fmt.Errorf("invalid @fk %q (expected column -> table.column)", spec)
+	}
+
+	return model.ForeignKey{
+		Name:             col,
+		ReferencedTable:  ref[:dot],
+		ReferencedColumn: ref[dot+1:],
+	}, nil
+}
+
+func parseCols(spec string, db *model.Database) ([]model.Column, error) {
+	if spec == "" {
+		return nil, errors.New("@cols requires a list like name:type,name:type")
+	}
+
+	// Defaults may be quoted strings containing commas, so split like a row
+	parts, err := splitRowTokens(spec)
+	if err != nil {
+		return nil, err
+	}
 	cols := make([]model.Column, 0, len(parts))
 
 	for _, p := range parts {
@@ -139,16 +317,16 @@ func parseCols(spec string) ([]model.Column, error) {
 		}
 
 		name := strings.TrimSpace(pair[0])
-		typ := model.ColumnType(strings.TrimSpace(pair[1]))
-
 		if name == "" {
 			return nil, fmt.Errorf("invalid column definition %q (missing name)", p)
 		}
-		if !typ.Valid() {
-			return nil, fmt.Errorf("invalid column type %q for column %q", string(typ), name)
+
+		col, err := parseColumnSpec(name, strings.TrimSpace(pair[1]), db)
+		if err != nil {
+			return nil, err
 		}
 
-		cols = append(cols, model.Column{Name: name, Type: typ})
+		cols = append(cols, col)
 	}
 
 	if len(cols) == 0 {
@@ -158,6 +336,54 @@ func parseCols(spec string) ([]model.Column, error) {
 	return cols, nil
 }
 
+// parseColumnSpec parses everything after the colon of a column definition:
+// the type, any "!notnull" / "!unique" / "!generated" modifiers, and an
+// optional "=default".
+func parseColumnSpec(name, spec string, db *model.Database) (model.Column, error) {
+	col := model.Column{Name: name}
+
+	defaultTok := ""
+	hasDefault := false
+	if eq := strings.Index(spec, "="); eq >= 0 {
+		defaultTok = strings.TrimSpace(spec[eq+1:])
+		spec = strings.TrimSpace(spec[:eq])
+		hasDefault = true
+	}
+
+	mods := strings.Split(spec, "!")
+	col.Type = model.ColumnType(strings.TrimSpace(mods[0]))
+	if !col.Type.Valid() {
+		if _, ok := db.EnumByName(string(col.Type)); !ok {
+			return model.Column{}, fmt.Errorf("invalid column type %q for column %q", string(col.Type), name)
+		}
+		col.Enum = string(col.Type)
+		col.Type = model.ColumnTypeEnum
+	}
+
+	for _, m := range mods[1:] {
+		switch strings.TrimSpace(m) {
+		case "notnull":
+			col.NotNull = true
+		case "unique":
+			col.Unique = true
+		case "generated":
+			col.Generated = true
+		default:
+			return model.Column{}, fmt.Errorf("unknown column modifier %q for column %q", "!"+m, name)
+		}
+	}
+
+	if hasDefault {
+		v, err := parseValue(defaultTok)
+		if err != nil {
+			return model.Column{}, fmt.Errorf("invalid default for column %q: %w", name, err)
+		}
+		col.Default = &v
+	}
+
+	return col, nil
+}
+
 func parseRow(line string) (model.Row, error) {
 	line = strings.TrimSpace(line)
 	if !strings.HasPrefix(line, "[") || !strings.HasSuffix(line, "]") {
@@ -202,19 +428,37 @@ func parseValue(tok string) (model.Value, error) {
 		return model.BoolValue(false), nil
 	}
 
-	if strings.HasPrefix(tok, "\"") {
-		s, err := parseDoubleQuotedString(tok)
+	// Blob literal: x'0a1b2c', hex digits in either case
+	if strings.HasPrefix(lower, "x'") {
+		if len(tok) < 3 || !strings.HasSuffix(tok, "'") {
+			return model.Value{}, fmt.Errorf("invalid blob literal %s", tok)
+		}
+		b, err := hex.DecodeString(tok[2 : len(tok)-1])
+		if err != nil {
+			return model.Value{}, fmt.Errorf("invalid blob literal %s: %w", tok, err)
+		}
+		return model.BlobValue(b), nil
+	}
+
+	// Datetime literal: t"2024-01-02T03:04:05Z"
+	if strings.HasPrefix(tok, "t\"") {
+		s, err := parseDoubleQuotedString(tok[1:])
 		if err != nil {
 			return model.Value{}, err
 		}
-		return model.TextValue(s), nil
+		ts, err := model.ParseDatetime(s)
+		if err != nil {
+			return model.Value{}, fmt.Errorf("invalid datetime literal %s (expected RFC 3339)", tok)
+		}
+		return model.DatetimeValue(ts), nil
 	}
 
-	if strings.Contains(tok, ".") {
-		f, err := strconv.ParseFloat(tok, 64)
-		if err == nil {
-			return model.DecimalValue(f), nil
+	if strings.HasPrefix(tok, "\"") {
+		s, err := parseDoubleQuotedString(tok)
+		if err != nil {
+			return model.Value{}, err
 		}
+		return model.TextValue(s), nil
 	}
 
 	i, err := strconv.ParseInt(tok, 10, 64)
@@ -222,6 +466,12 @@ func parseValue(tok string) (model.Value, error) {
 		return model.IntValue(i), nil
 	}
 
+	// Anything else numeric (fractions, exponents, integers beyond int64) is
+	// kept exactly as written
+	if d, err := model.ParseDecimal(tok); err == nil {
+		return model.DecimalValue(d), nil
+	}
+
 	return model.Value{}, fmt.Errorf("unable to parse value token %q", tok)
 }
 
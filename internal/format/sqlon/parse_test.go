@@ -1,8 +1,12 @@
 package sqlon
 
 import (
+	"bytes"
+	"reflect"
 	"strings"
 	"testing"
+
+	"sqlon/internal/model"
 )
 
 func TestParseBasicTable(t *testing.T) {
@@ -23,3 +27,254 @@ func TestParseBasicTable(t *testing.T) {
 		t.Fatalf("expected 1 table, got %d", len(db.Tables))
 	}
 }
+
+func TestParseForeignKeyDirective(t *testing.T) {
+	input := `
+@table parents
+@cols key:int, name:text
+@pk key
+
+@table parents_children
+@cols parents_id:int, owner:int, value:text
+@fk owner -> parents.key
+
+[1,1,"a"]
+`
+
+	db, err := Parse(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	child, ok := db.TableByName("parents_children")
+	if !ok {
+		t.Fatalf("missing table parents_children")
+	}
+	if len(child.ForeignKeys) != 1 {
+		t.Fatalf("expected only the declared FK, got %v", child.ForeignKeys)
+	}
+	fk := child.ForeignKeys[0]
+	if fk.Name != "owner" || fk.ReferencedTable != "parents" || fk.ReferencedColumn != "key" {
+		t.Fatalf("unexpected FK %+v", fk)
+	}
+}
+
+func TestParseRejectsMalformedForeignKey(t *testing.T) {
+	input := `
+@table t
+@cols a:int
+@fk a -> nowhere
+`
+
+	if _, err := Parse(strings.NewReader(input)); err == nil {
+		t.Fatalf("expected error for @fk without table.column")
+	}
+}
+
+func TestParseColumnModifiers(t *testing.T) {
+	input := `
+@table people
+@cols id:int, slug:text!notnull!unique, note:text="a, b", active:bool=false
+`
+
+	db, err := Parse(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	cols := db.Tables[0].Columns
+	if len(cols) != 4 {
+		t.Fatalf("expected 4 columns, got %d", len(cols))
+	}
+	if !cols[1].NotNull || !cols[1].Unique {
+		t.Errorf("expected slug to be not null and unique, got %+v", cols[1])
+	}
+	if cols[2].Default == nil || cols[2].Default.Text != "a, b" {
+		t.Errorf("expected note default \"a, b\", got %+v", cols[2].Default)
+	}
+	if got := cols[3].String(); got != "active:bool=false" {
+		t.Errorf("expected active:bool=false, got %s", got)
+	}
+}
+
+func TestParseGeneratedColumn(t *testing.T) {
+	input := "@table items\n@cols id:int!generated,n:text\n@pk id\n[1,\"a\"]\n"
+
+	db, err := Parse(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !db.Tables[0].Columns[0].Generated {
+		t.Errorf("expected id to be generated, got %+v", db.Tables[0].Columns[0])
+	}
+
+	var buf bytes.Buffer
+	if err := Format(&buf, db); err != nil {
+		t.Fatalf("format: %v", err)
+	}
+	if buf.String() != input {
+		t.Errorf("got:\n%s\nwant:\n%s", buf.String(), input)
+	}
+}
+
+func TestParseEnumColumn(t *testing.T) {
+	input := `
+@enum status = draft|live
+@table posts
+@cols id:int, status:status="draft"
+[1, "live"]
+`
+
+	db, err := Parse(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	col := db.Tables[0].Columns[1]
+	if col.Type != model.ColumnTypeEnum || col.Enum != "status" {
+		t.Errorf("expected an enum column of status, got %+v", col)
+	}
+
+	bad := strings.Replace(input, `"live"`, `"gone"`, 1)
+	_, err = Parse(strings.NewReader(bad))
+	if err == nil || !strings.Contains(err.Error(), "not in enum") {
+		t.Errorf("expected an error for a value outside the enum, got %v", err)
+	}
+}
+
+func TestDatetimeLiteralRoundtrip(t *testing.T) {
+	input := `@table events
+@cols at:datetime
+[t"2024-05-01T12:00:00+02:00"]
+`
+
+	db, err := Parse(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	v := db.Tables[0].Rows[0][0]
+	if v.Kind != model.ValueKindDatetime {
+		t.Fatalf("expected datetime value, got %s", v.Kind)
+	}
+
+	var buf strings.Builder
+	if err := Format(&buf, db); err != nil {
+		t.Fatalf("format: %v", err)
+	}
+	if !strings.Contains(buf.String(), `[t"2024-05-01T10:00:00Z"]`) {
+		t.Fatalf("expected canonical UTC literal, got:\n%s", buf.String())
+	}
+}
+
+func TestParseIndexDirective(t *testing.T) {
+	input := `
+@table posts
+@cols id:int, author:text, slug:text
+@index by_author (author)
+@index unique by_author_slug (author, slug)
+`
+
+	db, err := Parse(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	idx := db.Tables[0].Indexes
+	if len(idx) != 2 {
+		t.Fatalf("expected 2 indexes, got %d", len(idx))
+	}
+	if idx[0].Name != "by_author" || idx[0].Unique || len(idx[0].Columns) != 1 {
+		t.Errorf("unexpected first index %+v", idx[0])
+	}
+	if idx[1].Name != "by_author_slug" || !idx[1].Unique || len(idx[1].Columns) != 2 || idx[1].Columns[1] != "slug" {
+		t.Errorf("unexpected second index %+v", idx[1])
+	}
+}
+
+func TestIndexNameRoundtrip(t *testing.T) {
+	// Names imported from SQL may hold anything a quoted identifier can
+	names := []string{"by_author", "my idx", "odd (name), \"quoted\"", "unique"}
+
+	table := &model.Table{
+		Name:    "posts",
+		Columns: []model.Column{{Name: "author", Type: model.ColumnTypeText}},
+	}
+	for _, name := range names {
+		table.Indexes = append(table.Indexes, model.Index{Name: name, Columns: []string{"author"}, Unique: name == "my idx"})
+	}
+
+	var buf bytes.Buffer
+	if err := Format(&buf, &model.Database{Tables: []*model.Table{table}}); err != nil {
+		t.Fatalf("format: %v", err)
+	}
+	db, err := Parse(strings.NewReader(buf.String()))
+	if err != nil {
+		t.Fatalf("formatted output does not parse: %v\n%s", err, buf.String())
+	}
+	if got := db.Tables[0].Indexes; !reflect.DeepEqual(got, table.Indexes) {
+		t.Errorf("indexes = %+v, want %+v\n%s", got, table.Indexes, buf.String())
+	}
+}
+
+func TestFormatSkipsLinksToJSONRoot(t *testing.T) {
+	db := &model.Database{
+		Tables: []*model.Table{
+			{
+				Name:        "settings",
+				Columns:     []model.Column{{Name: "_id", Type: model.ColumnTypeInt}},
+				ForeignKeys: []model.ForeignKey{{Name: "_id", ReferencedTable: "", ReferencedColumn: "id"}},
+				Rows:        []model.Row{{model.IntValue(1)}},
+			},
+		},
+	}
+
+	var buf strings.Builder
+	if err := Format(&buf, db); err != nil {
+		t.Fatalf("format: %v", err)
+	}
+	if strings.Contains(buf.String(), "@fk") {
+		t.Fatalf("expected no @fk for a root link, got:\n%s", buf.String())
+	}
+	if _, err := Parse(strings.NewReader(buf.String())); err != nil {
+		t.Fatalf("formatted output does not parse: %v", err)
+	}
+}
+
+func TestFormatConflicts(t *testing.T) {
+	db := &model.Database{
+		Tables: []*model.Table{
+			{
+				Name:    "tags",
+				Columns: []model.Column{{Name: "id", Type: model.ColumnTypeInt}, {Name: "tag", Type: model.ColumnTypeText}},
+				PK:      []string{"id"},
+				Rows:    []model.Row{{model.IntValue(1), model.TextValue("a")}},
+			},
+		},
+	}
+	conflicts := []Conflict{
+		{Table: "tags", Before: 1, Ours: model.Row{model.IntValue(2), model.TextValue("b")}, Theirs: model.Row{model.IntValue(2), model.TextValue("c")}},
+		{Table: "tags", Before: 1, Theirs: model.Row{model.IntValue(3), model.TextValue("d")}},
+	}
+
+	var buf strings.Builder
+	if err := FormatConflicts(&buf, db, conflicts); err != nil {
+		t.Fatalf("format: %v", err)
+	}
+	want := `@table tags
+@cols id:int,tag:text
+@pk id
+[1,"a"]
+<<<<<<< ours
+[2,"b"]
+=======
+[2,"c"]
+>>>>>>> theirs
+<<<<<<< ours
+=======
+[3,"d"]
+>>>>>>> theirs
+`
+	if buf.String() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
@@ -3,11 +3,42 @@ package sqlon
 import (
 	"fmt"
 	"io"
+	"strconv"
+	"strings"
 
 	"sqlon/internal/model"
 )
 
 func Format(w io.Writer, db *model.Database) error {
+	return FormatConflicts(w, db, nil)
+}
+
+// Conflict is a row that a merge could not resolve. It is written between
+// git-style conflict markers, our version first; a nil version was deleted
+// on that side.
+type Conflict struct {
+	Table  string
+	Before int // index of the table row the conflict is written before
+	Ours   model.Row
+	Theirs model.Row
+}
+
+// FormatConflicts writes db like Format, with each conflict placed among
+// the rows of its table. The result doesn't parse until every conflict has
+// been resolved by hand.
+func FormatConflicts(w io.Writer, db *model.Database, conflicts []Conflict) error {
+	// Enums come first so that @cols can refer to them
+	for _, e := range db.Enums {
+		if _, err := fmt.Fprintf(w, "@enum %s = %s\n", e.Name, strings.Join(e.Values, "|")); err != nil {
+			return err
+		}
+	}
+	if len(db.Enums) > 0 && len(db.Tables) > 0 {
+		if _, err := io.WriteString(w, "\n"); err != nil {
+			return err
+		}
+	}
+
 	for ti, table := range db.Tables {
 		if ti > 0 {
 			if _, err := io.WriteString(w, "\n"); err != nil {
@@ -23,22 +54,56 @@ func Format(w io.Writer, db *model.Database) error {
 		// Write @cols directive
 		cols := make([]string, 0, len(table.Columns))
 		for _, col := range table.Columns {
-			cols = append(cols, fmt.Sprintf("%s:%s", col.Name, string(col.Type)))
+			cols = append(cols, col.String())
 		}
 		if _, err := fmt.Fprintf(w, "@cols %s\n", joinColumns(cols)); err != nil {
 			return err
 		}
 
 		// Write @pk directive if present
-		if table.PK != "" {
-			if _, err := fmt.Fprintf(w, "@pk %s\n", table.PK); err != nil {
+		if len(table.PK) > 0 {
+			if _, err := fmt.Fprintf(w, "@pk %s\n", joinColumns(table.PK)); err != nil {
+				return err
+			}
+		}
+
+		// Write @fk directives. Tables nested directly under the JSON root
+		// link to the root with an empty table name, which has no table to
+		// point @fk at, so those links are not written: the file keeps their
+		// column as plain data, and parsing it back yields no foreign key.
+		for _, fk := range table.ForeignKeys {
+			if fk.ReferencedTable == "" {
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "@fk %s -> %s.%s\n", fk.Name, fk.ReferencedTable, fk.ReferencedColumn); err != nil {
+				return err
+			}
+		}
+
+		// Write @index directives
+		for _, idx := range table.Indexes {
+			unique := ""
+			if idx.Unique {
+				unique = "unique "
+			}
+			if _, err := fmt.Fprintf(w, "@index %s%s (%s)\n", unique, indexName(idx.Name), strings.Join(idx.Columns, ", ")); err != nil {
 				return err
 			}
 		}
 
-		// Write rows
-		for _, row := range table.Rows {
-			if err := formatRow(w, row); err != nil {
+		// Write rows, with any conflicts in between
+		for i := 0; i <= len(table.Rows); i++ {
+			for _, c := range conflicts {
+				if c.Table == table.Name && c.Before == i {
+					if err := formatConflict(w, c); err != nil {
+						return err
+					}
+				}
+			}
+			if i == len(table.Rows) {
+				break
+			}
+			if err := formatRow(w, table.Rows[i]); err != nil {
 				return err
 			}
 			if _, err := io.WriteString(w, "\n"); err != nil {
@@ -50,6 +115,31 @@ func Format(w io.Writer, db *model.Database) error {
 	return nil
 }
 
+func formatConflict(w io.Writer, c Conflict) error {
+	for _, part := range []struct {
+		marker string
+		row    model.Row
+	}{
+		{"<<<<<<< ours\n", c.Ours},
+		{"=======\n", c.Theirs},
+	} {
+		if _, err := io.WriteString(w, part.marker); err != nil {
+			return err
+		}
+		if part.row == nil {
+			continue
+		}
+		if err := formatRow(w, part.row); err != nil {
+			return err
+		}
+		if _, err := io.WriteString(w, "\n"); err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(w, ">>>>>>> theirs\n")
+	return err
+}
+
 func joinColumns(cols []string) string {
 	if len(cols) == 0 {
 		return ""
@@ -96,7 +186,7 @@ func formatValue(w io.Writer, v model.Value) error {
 			return err
 		}
 	case model.ValueKindDecimal:
-		if _, err := fmt.Fprintf(w, "%g", v.Float64); err != nil {
+		if _, err := io.WriteString(w, v.Decimal.String()); err != nil {
 			return err
 		}
 	case model.ValueKindBool:
@@ -113,6 +203,14 @@ func formatValue(w io.Writer, v model.Value) error {
 		if _, err := fmt.Fprintf(w, "%q", v.Text); err != nil {
 			return err
 		}
+	case model.ValueKindDatetime:
+		if _, err := fmt.Fprintf(w, "t%q", model.FormatDatetime(v.Time)); err != nil {
+			return err
+		}
+	case model.ValueKindBlob:
+		if _, err := fmt.Fprintf(w, "x'%x'", v.Bytes); err != nil {
+			return err
+		}
 	default:
 		if _, err := io.WriteString(w, "null"); err != nil {
 			return err
@@ -120,3 +218,12 @@ func formatValue(w io.Writer, v model.Value) error {
 	}
 	return nil
 }
+
+// indexName renders an index name for @index, quoting names that would
+// otherwise not read back, such as those with spaces imported from SQL.
+func indexName(name string) string {
+	if name == "" || name == "unique" || strings.ContainsAny(name, " \t(),\"") {
+		return strconv.Quote(name)
+	}
+	return name
+}
@@ -0,0 +1,428 @@
+// Package merge combines two versions of a database that were edited
+// independently from a common base, as git does for text files.
+package merge
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"sqlon/internal/format/sqlon"
+	"sqlon/internal/model"
+)
+
+// Result is a merged database along with the rows that could not be
+// merged. Conflicting rows are not in the database's tables; format the
+// result with sqlon.FormatConflicts to place them.
+type Result struct {
+	Database  *model.Database
+	Conflicts []sqlon.Conflict
+}
+
+// Merge combines the changes ours and theirs each made to base.
+//
+// Rows are matched on the primary key. A row changed on one side only takes
+// that change, and a row changed on both sides is merged column by column;
+// it conflicts only when both sides changed the same column differently, or
+// one side deleted a row the other changed. Rows of a table without a
+// primary key are merged as a multiset: each side's insertions and
+// deletions are applied.
+//
+// Schema changes (enums, columns, keys, indexes, whole tables) are taken
+// from whichever side made them. When both sides changed the same table's
+// schema differently there is no row-level answer, so Merge returns an
+// error.
+func Merge(base, ours, theirs *model.Database) (*Result, error) {
+	enums, err := mergeEnums(base, ours, theirs)
+	if err != nil {
+		return nil, err
+	}
+	res := &Result{Database: &model.Database{Enums: enums}}
+
+	names := make([]string, 0, len(ours.Tables)+len(theirs.Tables))
+	for _, t := range ours.Tables {
+		names = append(names, t.Name)
+	}
+	for _, t := range theirs.Tables {
+		if _, ok := ours.TableByName(t.Name); !ok {
+			names = append(names, t.Name)
+		}
+	}
+
+	for _, name := range names {
+		bt, _ := base.TableByName(name)
+		ot, inOurs := ours.TableByName(name)
+		tt, inTheirs := theirs.TableByName(name)
+
+		switch {
+		case inOurs && inTheirs:
+			t, conflicts, err := mergeTable(bt, ot, tt)
+			if err != nil {
+				return nil, err
+			}
+			res.Database.Tables = append(res.Database.Tables, t)
+			res.Conflicts = append(res.Conflicts, conflicts...)
+		case bt == nil:
+			// Added on one side
+			if inOurs {
+				res.Database.Tables = append(res.Database.Tables, ot)
+			} else {
+				res.Database.Tables = append(res.Database.Tables, tt)
+			}
+		default:
+			// Dropped on one side, which only stands if the other left it be
+			kept, keptBy := ot, "our"
+			if !inOurs {
+				kept, keptBy = tt, "their"
+			}
+			if tableKey(kept) != tableKey(bt) {
+				return nil, fmt.Errorf("table %q was changed on %s side and dropped on the other", name, keptBy)
+			}
+		}
+	}
+
+	return res, nil
+}
+
+// Files merges three versions of a SQLON file, as Merge does. The result
+// is written afresh from the merged rows, which would drop comments and any
+// layout of the file's own, so every version must read exactly as
+// sqlon.Format writes it; otherwise Files returns an error and the merge is
+// better left to a line-based tool.
+func Files(base, ours, theirs []byte) (*Result, error) {
+	versions := []struct {
+		name string
+		src  []byte
+	}{{"base", base}, {"ours", ours}, {"theirs", theirs}}
+
+	dbs := make([]*model.Database, 0, len(versions))
+	for _, v := range versions {
+		db, err := sqlon.Parse(bytes.NewReader(v.src))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", v.name, err)
+		}
+		var formatted bytes.Buffer
+		if err := sqlon.Format(&formatted, db); err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(formatted.Bytes(), v.src) {
+			return nil, fmt.Errorf("%s has comments or formatting that a row merge would drop", v.name)
+		}
+		dbs = append(dbs, db)
+	}
+	return Merge(dbs[0], dbs[1], dbs[2])
+}
+
+// side is the version a three-way comparison settles on.
+type side int
+
+const (
+	sideOurs side = iota
+	sideTheirs
+	sideConflict
+)
+
+// pick compares the keys of the three versions of something. A side that
+// matches the base made no change, so the other side's version wins.
+func pick(base, ours, theirs string) side {
+	switch {
+	case ours == theirs, theirs == base:
+		return sideOurs
+	case ours == base:
+		return sideTheirs
+	default:
+		return sideConflict
+	}
+}
+
+func mergeEnums(base, ours, theirs *model.Database) ([]model.Enum, error) {
+	key := func(db *model.Database, name string) string {
+		e, ok := db.EnumByName(name)
+		if !ok {
+			return ""
+		}
+		// Never empty, unlike a missing enum's key
+		return "=" + strings.Join(e.Values, "|")
+	}
+
+	var names []string
+	for _, e := range ours.Enums {
+		names = append(names, e.Name)
+	}
+	for _, e := range theirs.Enums {
+		if _, ok := ours.EnumByName(e.Name); !ok {
+			names = append(names, e.Name)
+		}
+	}
+
+	var enums []model.Enum
+	for _, name := range names {
+		from := ours
+		switch pick(key(base, name), key(ours, name), key(theirs, name)) {
+		case sideTheirs:
+			from = theirs
+		case sideConflict:
+			return nil, fmt.Errorf("enum %q was changed differently on both sides", name)
+		}
+		if e, ok := from.EnumByName(name); ok {
+			enums = append(enums, *e)
+		}
+	}
+	return enums, nil
+}
+
+// schemaKey renders everything about t except its rows.
+func schemaKey(t *model.Table) string {
+	if t == nil {
+		return ""
+	}
+	cols := make([]string, 0, len(t.Columns))
+	for _, c := range t.Columns {
+		cols = append(cols, c.String())
+	}
+	return fmt.Sprintf("%s|%v|%v|%v", strings.Join(cols, ","), t.PK, t.ForeignKeys, t.Indexes)
+}
+
+// tableKey renders t, rows and all.
+func tableKey(t *model.Table) string {
+	var b strings.Builder
+	b.WriteString(schemaKey(t))
+	all := make([]int, len(t.Columns))
+	for i := range all {
+		all[i] = i
+	}
+	for _, row := range t.Rows {
+		b.WriteString("\n")
+		b.WriteString(model.RowKey(row, all))
+	}
+	return b.String()
+}
+
+func mergeTable(bt, ot, tt *model.Table) (*model.Table, []sqlon.Conflict, error) {
+	schema := ot
+	switch pick(schemaKey(bt), schemaKey(ot), schemaKey(tt)) {
+	case sideTheirs:
+		schema = tt
+	case sideConflict:
+		return nil, nil, fmt.Errorf("table %q: the schema was changed differently on both sides", ot.Name)
+	}
+
+	merged := &model.Table{
+		Name:        schema.Name,
+		Columns:     schema.Columns,
+		PK:          schema.PK,
+		ForeignKeys: schema.ForeignKeys,
+		Indexes:     schema.Indexes,
+	}
+
+	// Every version's rows are laid out like the merged columns, so that a
+	// column added on one side doesn't read as a change to every row
+	var base []model.Row
+	if bt != nil {
+		base = remap(bt, merged)
+	}
+	ours, theirs := remap(ot, merged), remap(tt, merged)
+
+	if idx, ok := merged.PKIndexes(); ok {
+		// Rows are matched on the key, so a version holding two rows with
+		// one key can't be merged without losing one of them
+		versions := []struct {
+			name string
+			rows []model.Row
+		}{{"base", base}, {"ours", ours}, {"theirs", theirs}}
+		for _, v := range versions {
+			if key, dup := duplicateKey(v.rows, idx); dup {
+				return nil, nil, fmt.Errorf("table %q: %s has more than one row with key %s", merged.Name, v.name, key)
+			}
+		}
+
+		var conflicts []sqlon.Conflict
+		merged.Rows, conflicts = mergeKeyed(merged.Name, base, ours, theirs, idx)
+		return merged, conflicts, nil
+	}
+	merged.Rows = mergeMultiset(base, ours, theirs, len(merged.Columns))
+	return merged, nil, nil
+}
+
+// remap lays the rows of src out like the columns of dst, matching columns
+// by name. Columns src doesn't have take their default, or null.
+func remap(src, dst *model.Table) []model.Row {
+	from := make([]int, len(dst.Columns))
+	for i, c := range dst.Columns {
+		from[i] = -1
+		if j, ok := src.ColumnIndex(c.Name); ok {
+			from[i] = j
+		}
+	}
+
+	rows := make([]model.Row, 0, len(src.Rows))
+	for _, row := range src.Rows {
+		out := make(model.Row, len(dst.Columns))
+		for i, j := range from {
+			switch {
+			case j >= 0 && j < len(row):
+				out[i] = row[j]
+			case j < 0 && dst.Columns[i].Default != nil:
+				out[i] = *dst.Columns[i].Default
+			default:
+				out[i] = model.NullValue()
+			}
+		}
+		rows = append(rows, out)
+	}
+	return rows
+}
+
+// duplicateKey reports the first key, as comma-separated values, that
+// more than one of rows has in the columns idx.
+func duplicateKey(rows []model.Row, idx []int) (string, bool) {
+	seen := make(map[string]bool, len(rows))
+	for _, row := range rows {
+		k := model.RowKey(row, idx)
+		if seen[k] {
+			vals := make([]string, len(idx))
+			for n, i := range idx {
+				vals[n] = row.At(i).String()
+			}
+			return strings.Join(vals, ","), true
+		}
+		seen[k] = true
+	}
+	return "", false
+}
+
+// mergeKeyed merges rows matched on the key columns idx, each of which
+// must be distinct within a version. The result keeps
+// our row order; rows only they have follow the row they followed on their
+// side.
+func mergeKeyed(table string, base, ours, theirs []model.Row, idx []int) ([]model.Row, []sqlon.Conflict) {
+	byKey := func(rows []model.Row) map[string]model.Row {
+		m := make(map[string]model.Row, len(rows))
+		for _, row := range rows {
+			m[model.RowKey(row, idx)] = row
+		}
+		return m
+	}
+	baseRows, ourRows, theirRows := byKey(base), byKey(ours), byKey(theirs)
+
+	// Their rows that we don't have, grouped by the nearest row before them
+	// that we do have. The empty key stands for the start of the table.
+	after := make(map[string][]string)
+	anchor := ""
+	for _, row := range theirs {
+		k := model.RowKey(row, idx)
+		if _, ok := ourRows[k]; ok {
+			anchor = k
+			continue
+		}
+		after[anchor] = append(after[anchor], k)
+	}
+
+	var rows []model.Row
+	var conflicts []sqlon.Conflict
+	done := make(map[string]bool)
+	resolve := func(k string) {
+		if done[k] {
+			return
+		}
+		done[k] = true
+		o, t := ourRows[k], theirRows[k]
+		row, ok := mergeRow(baseRows[k], o, t)
+		if !ok {
+			conflicts = append(conflicts, sqlon.Conflict{Table: table, Before: len(rows), Ours: o, Theirs: t})
+			return
+		}
+		if row != nil {
+			rows = append(rows, row)
+		}
+	}
+
+	for _, k := range after[""] {
+		resolve(k)
+	}
+	for _, row := range ours {
+		k := model.RowKey(row, idx)
+		resolve(k)
+		for _, next := range after[k] {
+			resolve(next)
+		}
+	}
+	return rows, conflicts
+}
+
+// mergeRow merges one row's three versions, any of which may be nil for a
+// row that doesn't exist there. It returns nil for a deleted row, and false
+// when the versions conflict.
+func mergeRow(base, ours, theirs model.Row) (model.Row, bool) {
+	switch {
+	case equalRows(ours, theirs), equalRows(theirs, base):
+		return ours, true
+	case equalRows(ours, base):
+		return theirs, true
+	case base == nil || ours == nil || theirs == nil:
+		// Added differently on both sides, or changed on one and deleted
+		// on the other
+		return nil, false
+	}
+
+	merged := make(model.Row, len(ours))
+	for i := range ours {
+		switch pick(base[i].Key(), ours[i].Key(), theirs[i].Key()) {
+		case sideOurs:
+			merged[i] = ours[i]
+		case sideTheirs:
+			merged[i] = theirs[i]
+		default:
+			return nil, false
+		}
+	}
+	return merged, true
+}
+
+func equalRows(a, b model.Row) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Key() != b[i].Key() {
+			return false
+		}
+	}
+	return true
+}
+
+// mergeMultiset merges rows of width columns without a key. Each distinct row appears as
+// many times as both sides' changes to its count add up to, in our order
+// followed by their additions.
+func mergeMultiset(base, ours, theirs []model.Row, width int) []model.Row {
+	all := make([]int, width)
+	for i := range all {
+		all[i] = i
+	}
+
+	remaining := make(map[string]int)
+	for _, row := range ours {
+		remaining[model.RowKey(row, all)]++
+	}
+	for _, row := range theirs {
+		remaining[model.RowKey(row, all)]++
+	}
+	for _, row := range base {
+		remaining[model.RowKey(row, all)]--
+	}
+
+	var rows []model.Row
+	for _, version := range [][]model.Row{ours, theirs} {
+		for _, row := range version {
+			k := model.RowKey(row, all)
+			if remaining[k] > 0 {
+				rows = append(rows, row)
+				remaining[k]--
+			}
+		}
+	}
+	return rows
+}
@@ -0,0 +1,216 @@
+package merge
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"sqlon/internal/format/sqlon"
+	"sqlon/internal/model"
+)
+
+func parse(t *testing.T, src string) *model.Database {
+	t.Helper()
+	db, err := sqlon.Parse(strings.NewReader(src))
+	if err != nil {
+		t.Fatalf("parse: %v\n%s", err, src)
+	}
+	return db
+}
+
+func mergeText(t *testing.T, base, ours, theirs string) (string, int) {
+	t.Helper()
+	res, err := Merge(parse(t, base), parse(t, ours), parse(t, theirs))
+	if err != nil {
+		t.Fatalf("merge: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := sqlon.FormatConflicts(&buf, res.Database, res.Conflicts); err != nil {
+		t.Fatalf("format: %v", err)
+	}
+	return buf.String(), len(res.Conflicts)
+}
+
+const mergeBase = `@table posts
+@cols id:int,title:text,score:int
+@pk id
+[1,"One",1]
+[2,"Two",2]
+[3,"Three",3]
+`
+
+func TestMergeKeyedRows(t *testing.T) {
+	ours := `@table posts
+@cols id:int,title:text,score:int
+@pk id
+[1,"One!",1]
+[2,"Two",2]
+[4,"Four",4]
+`
+	theirs := `@table posts
+@cols id:int,title:text,score:int
+@pk id
+[5,"Five",5]
+[1,"One",10]
+[2,"Two",2]
+[3,"Three",3]
+`
+	got, conflicts := mergeText(t, mergeBase, ours, theirs)
+	// Both edits to row 1 land, our deletion of row 3 stands, and their
+	// new row keeps its place before row 1
+	want := `@table posts
+@cols id:int,title:text,score:int
+@pk id
+[5,"Five",5]
+[1,"One!",10]
+[2,"Two",2]
+[4,"Four",4]
+`
+	if conflicts != 0 || got != want {
+		t.Errorf("got %d conflict(s):\n%s\nwant:\n%s", conflicts, got, want)
+	}
+}
+
+func TestMergeConflictingRows(t *testing.T) {
+	ours := `@table posts
+@cols id:int,title:text,score:int
+@pk id
+[1,"Ours",1]
+[3,"Three",30]
+`
+	theirs := `@table posts
+@cols id:int,title:text,score:int
+@pk id
+[1,"Theirs",1]
+[2,"Two",20]
+`
+	got, conflicts := mergeText(t, mergeBase, ours, theirs)
+	want := `@table posts
+@cols id:int,title:text,score:int
+@pk id
+<<<<<<< ours
+[1,"Ours",1]
+=======
+[1,"Theirs",1]
+>>>>>>> theirs
+<<<<<<< ours
+=======
+[2,"Two",20]
+>>>>>>> theirs
+<<<<<<< ours
+[3,"Three",30]
+=======
+>>>>>>> theirs
+`
+	if conflicts != 3 || got != want {
+		t.Errorf("got %d conflict(s):\n%s\nwant:\n%s", conflicts, got, want)
+	}
+}
+
+func TestMergeAddedColumn(t *testing.T) {
+	ours := `@table posts
+@cols id:int,title:text,score:int,draft:bool=false
+@pk id
+[1,"One",1,true]
+[2,"Two",2,false]
+[3,"Three",3,false]
+`
+	theirs := `@table posts
+@cols id:int,title:text,score:int
+@pk id
+[1,"One",1]
+[2,"Two!",2]
+[3,"Three",3]
+`
+	got, conflicts := mergeText(t, mergeBase, ours, theirs)
+	want := `@table posts
+@cols id:int,title:text,score:int,draft:bool=false
+@pk id
+[1,"One",1,true]
+[2,"Two!",2,false]
+[3,"Three",3,false]
+`
+	if conflicts != 0 || got != want {
+		t.Errorf("got %d conflict(s):\n%s\nwant:\n%s", conflicts, got, want)
+	}
+}
+
+func TestMergeRowsWithoutKey(t *testing.T) {
+	base := "@table tags\n@cols tag:text\n[\"a\"]\n[\"b\"]\n[\"b\"]\n"
+	ours := "@table tags\n@cols tag:text\n[\"b\"]\n[\"b\"]\n[\"c\"]\n"
+	theirs := "@table tags\n@cols tag:text\n[\"a\"]\n[\"b\"]\n[\"d\"]\n"
+
+	got, conflicts := mergeText(t, base, ours, theirs)
+	want := "@table tags\n@cols tag:text\n[\"b\"]\n[\"c\"]\n[\"d\"]\n"
+	if conflicts != 0 || got != want {
+		t.Errorf("got %d conflict(s):\n%s\nwant:\n%s", conflicts, got, want)
+	}
+}
+
+func TestMergeTables(t *testing.T) {
+	base := mergeBase + "\n@table old\n@cols x:int\n[1]\n"
+	ours := mergeBase
+	theirs := mergeBase + "\n@table old\n@cols x:int\n[1]\n\n@table added\n@cols y:int\n[2]\n"
+
+	got, conflicts := mergeText(t, base, ours, theirs)
+	want := mergeBase + "\n@table added\n@cols y:int\n[2]\n"
+	if conflicts != 0 || got != want {
+		t.Errorf("got %d conflict(s):\n%s\nwant:\n%s", conflicts, got, want)
+	}
+}
+
+func TestMergeSchemaConflict(t *testing.T) {
+	ours := strings.Replace(mergeBase, "score:int", "score:decimal", 1)
+	theirs := strings.Replace(mergeBase, "score:int", "score:text", 1)
+	if _, err := Merge(parse(t, mergeBase), parse(t, ours), parse(t, theirs)); err == nil {
+		t.Error("expected an error for conflicting schema changes")
+	}
+
+	dropped := "@table other\n@cols x:int\n"
+	changed := strings.Replace(mergeBase, `"One"`, `"Uno"`, 1)
+	if _, err := Merge(parse(t, mergeBase), parse(t, dropped), parse(t, changed)); err == nil {
+		t.Error("expected an error for a table dropped on one side and changed on the other")
+	}
+}
+
+func TestMergeDuplicateKeys(t *testing.T) {
+	dup := mergeBase + "[2,\"Deux\",2]\n"
+	changed := strings.Replace(mergeBase, `"One"`, `"Uno"`, 1)
+	for name, v := range map[string][3]string{
+		"base":   {dup, mergeBase, changed},
+		"ours":   {mergeBase, dup, changed},
+		"theirs": {mergeBase, changed, dup},
+	} {
+		_, err := Merge(parse(t, v[0]), parse(t, v[1]), parse(t, v[2]))
+		if err == nil || !strings.Contains(err.Error(), name) {
+			t.Errorf("%s: expected an error naming the version with key 2 twice, got %v", name, err)
+		}
+	}
+}
+
+func TestFiles(t *testing.T) {
+	ours := strings.Replace(mergeBase, `"One"`, `"Uno"`, 1)
+	theirs := strings.Replace(mergeBase, `"Two"`, `"Dos"`, 1)
+	res, err := Files([]byte(mergeBase), []byte(ours), []byte(theirs))
+	if err != nil {
+		t.Fatalf("merge: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := sqlon.Format(&buf, res.Database); err != nil {
+		t.Fatalf("format: %v", err)
+	}
+	if want := strings.Replace(ours, `"Two"`, `"Dos"`, 1); buf.String() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
+
+func TestFilesRefusesWhatFormatWouldDrop(t *testing.T) {
+	commented := strings.Replace(mergeBase, "@pk id\n", "@pk id\n# keep this note\n", 1)
+	spaced := strings.Replace(mergeBase, "id:int,title:text", "id:int, title:text", 1)
+
+	for name, theirs := range map[string]string{"comment": commented, "layout": spaced} {
+		if _, err := Files([]byte(mergeBase), []byte(mergeBase), []byte(theirs)); err == nil {
+			t.Errorf("%s: expected an error rather than a merge that drops it", name)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package model
+
+import (
+	"fmt"
+	"math/big"
+	"regexp"
+)
+
+// Decimal is an exact decimal number kept as its literal text, e.g. "19.90"
+// or "1e+06". Holding the text rather than a float64 means values survive
+// every format conversion byte-for-byte, trailing zeros included.
+type Decimal string
+
+// decimalRegex is the JSON number grammar, which SQLON and SQL both accept.
+var decimalRegex = regexp.MustCompile(`^-?(0|[1-9][0-9]*)(\.[0-9]+)?([eE][+-]?[0-9]+)?$`)
+
+// ParseDecimal validates s as a decimal literal.
+func ParseDecimal(s string) (Decimal, error) {
+	if !decimalRegex.MatchString(s) {
+		return "", fmt.Errorf("invalid decimal %q", s)
+	}
+	return Decimal(s), nil
+}
+
+func (d Decimal) String() string {
+	return string(d)
+}
+
+// Rat returns the exact value of d. It returns nil if d is not a valid
+// decimal literal.
+func (d Decimal) Rat() *big.Rat {
+	r, ok := new(big.Rat).SetString(string(d))
+	if !ok {
+		return nil
+	}
+	return r
+}
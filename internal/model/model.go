@@ -1,7 +1,11 @@
 package model
 
 import (
+	"encoding/hex"
 	"fmt"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type ColumnType string
@@ -13,21 +17,80 @@ const (
 	ColumnTypeDecimal  ColumnType = "decimal"
 	ColumnTypeDatetime ColumnType = "datetime"
 	ColumnTypeNull     ColumnType = "null"
+	ColumnTypeBlob     ColumnType = "blob"
+
+	// ColumnTypeEnum marks a column whose values come from a declared Enum,
+	// named by Column.Enum. It is never written literally in @cols.
+	ColumnTypeEnum ColumnType = "enum"
 )
 
+// Valid reports whether t is a built-in type that may be written directly in
+// @cols. Enum columns are written using the enum's name instead.
 func (t ColumnType) Valid() bool {
 	switch t {
-	case ColumnTypeInt, ColumnTypeText, ColumnTypeBool, ColumnTypeDecimal, ColumnTypeDatetime, ColumnTypeNull:
+	case ColumnTypeInt, ColumnTypeText, ColumnTypeBool, ColumnTypeDecimal, ColumnTypeDatetime, ColumnTypeNull, ColumnTypeBlob:
 		return true
 	default:
 		return false
 	}
 }
 
+// Accepts reports whether a value of kind k may be stored in a column of
+// type t. Null is accepted by every column type.
+func (t ColumnType) Accepts(k ValueKind) bool {
+	if k == ValueKindNull {
+		return true
+	}
+	switch t {
+	case ColumnTypeInt:
+		return k == ValueKindInt
+	case ColumnTypeDecimal:
+		return k == ValueKindDecimal || k == ValueKindInt
+	case ColumnTypeBool:
+		return k == ValueKindBool
+	case ColumnTypeText, ColumnTypeEnum:
+		return k == ValueKindText
+	case ColumnTypeDatetime:
+		return k == ValueKindDatetime
+	case ColumnTypeBlob:
+		return k == ValueKindBlob
+	case ColumnTypeNull:
+		return false
+	default:
+		return false
+	}
+}
+
 type Database struct {
+	Enums  []Enum
 	Tables []*Table
 }
 
+// Enum is a named, ordered set of text values that enum columns draw from.
+type Enum struct {
+	Name   string
+	Values []string
+}
+
+// Has reports whether v is one of the enum's values.
+func (e Enum) Has(v string) bool {
+	for _, ev := range e.Values {
+		if ev == v {
+			return true
+		}
+	}
+	return false
+}
+
+func (db *Database) EnumByName(name string) (*Enum, bool) {
+	for i := range db.Enums {
+		if db.Enums[i].Name == name {
+			return &db.Enums[i], true
+		}
+	}
+	return nil, false
+}
+
 func (db *Database) TableByName(name string) (*Table, bool) {
 	for _, t := range db.Tables {
 		if t.Name == name {
@@ -40,9 +103,16 @@ func (db *Database) TableByName(name string) (*Table, bool) {
 type Table struct {
 	Name        string
 	Columns     []Column
-	PK          string
+	PK          []string
 	Rows        []Row
 	ForeignKeys []ForeignKey
+	Indexes     []Index
+}
+
+type Index struct {
+	Name    string
+	Columns []string
+	Unique  bool
 }
 
 type ForeignKey struct {
@@ -68,17 +138,93 @@ func (t *Table) ColumnIndex(name string) (int, bool) {
 	return -1, false
 }
 
+// IsPK reports whether name is one of the table's primary key columns.
+func (t *Table) IsPK(name string) bool {
+	for _, pk := range t.PK {
+		if pk == name {
+			return true
+		}
+	}
+	return false
+}
+
+// PKIndexes returns the column positions of the primary key in key order.
+// ok is false when the table has no primary key or names a missing column.
+func (t *Table) PKIndexes() ([]int, bool) {
+	if len(t.PK) == 0 {
+		return nil, false
+	}
+	idx := make([]int, 0, len(t.PK))
+	for _, name := range t.PK {
+		i, ok := t.ColumnIndex(name)
+		if !ok {
+			return nil, false
+		}
+		idx = append(idx, i)
+	}
+	return idx, true
+}
+
+// RowKey builds a map key from the values of row at the given positions.
+// Positions past the end of the row contribute a null.
+func RowKey(row Row, idx []int) string {
+	var b strings.Builder
+	for n, i := range idx {
+		if n > 0 {
+			b.WriteByte(0)
+		}
+		b.WriteString(row.At(i).Key())
+	}
+	return b.String()
+}
+
 type Column struct {
-	Name string
-	Type ColumnType
+	Name    string
+	Type    ColumnType
+	Enum    string // Name of the Enum for ColumnTypeEnum columns
+	NotNull bool   // Rows may not hold null in this column
+	Unique  bool   // Non-null values must be distinct across rows
+	Default *Value // Value assumed when none is given; nil means no default
+
+	// Generated marks a column an importer added rather than read from the
+	// source, such as the keys the JSON normaliser gives parent tables
+	Generated bool
 }
 
+// String renders the column as it appears in @cols, including modifiers,
+// e.g. "slug:text!notnull!unique" or "active:bool=false".
 func (c Column) String() string {
-	return fmt.Sprintf("%s:%s", c.Name, string(c.Type))
+	typ := string(c.Type)
+	if c.Type == ColumnTypeEnum {
+		typ = c.Enum
+	}
+	s := fmt.Sprintf("%s:%s", c.Name, typ)
+	if c.NotNull {
+		s += "!notnull"
+	}
+	if c.Unique {
+		s += "!unique"
+	}
+	if c.Generated {
+		s += "!generated"
+	}
+	if c.Default != nil {
+		s += "=" + c.Default.String()
+	}
+	return s
 }
 
 type Row []Value
 
+// At returns the value at position i, or null for a row too short to
+// have it.
+func (r Row) At(i int) Value {
+	if i >= 0 && i < len(r) {
+		return r[i]
+	}
+	return NullValue()
+}
+
 type ValueKind int
 
 const (
@@ -87,14 +233,39 @@ const (
 	ValueKindDecimal
 	ValueKindBool
 	ValueKindText
+	ValueKindDatetime
+	ValueKindBlob
 )
 
+func (k ValueKind) String() string {
+	switch k {
+	case ValueKindNull:
+		return "null"
+	case ValueKindInt:
+		return "int"
+	case ValueKindDecimal:
+		return "decimal"
+	case ValueKindBool:
+		return "bool"
+	case ValueKindText:
+		return "text"
+	case ValueKindDatetime:
+		return "datetime"
+	case ValueKindBlob:
+		return "blob"
+	default:
+		return "unknown"
+	}
+}
+
 type Value struct {
 	Kind    ValueKind
 	Int64   int64
-	Float64 float64
+	Decimal Decimal
 	Bool    bool
 	Text    string
+	Time    time.Time
+	Bytes   []byte
 }
 
 func NullValue() Value {
@@ -105,8 +276,8 @@ func IntValue(v int64) Value {
 	return Value{Kind: ValueKindInt, Int64: v}
 }
 
-func DecimalValue(v float64) Value {
-	return Value{Kind: ValueKindDecimal, Float64: v}
+func DecimalValue(v Decimal) Value {
+	return Value{Kind: ValueKindDecimal, Decimal: v}
 }
 
 func BoolValue(v bool) Value {
@@ -116,3 +287,61 @@ func BoolValue(v bool) Value {
 func TextValue(v string) Value {
 	return Value{Kind: ValueKindText, Text: v}
 }
+
+func DatetimeValue(v time.Time) Value {
+	return Value{Kind: ValueKindDatetime, Time: v.UTC()}
+}
+
+func BlobValue(v []byte) Value {
+	return Value{Kind: ValueKindBlob, Bytes: v}
+}
+
+// FormatDatetime renders t in the canonical datetime form: RFC 3339 in UTC,
+// with fractional seconds only when they are non-zero.
+func FormatDatetime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+// ParseDatetime parses an RFC 3339 timestamp, with or without fractional
+// seconds. The result is normalised to UTC.
+func ParseDatetime(s string) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return t.UTC(), nil
+}
+
+// String renders v the way it would appear in a SQLON row.
+func (v Value) String() string {
+	switch v.Kind {
+	case ValueKindNull:
+		return "null"
+	case ValueKindInt:
+		return strconv.FormatInt(v.Int64, 10)
+	case ValueKindDecimal:
+		return v.Decimal.String()
+	case ValueKindBool:
+		return strconv.FormatBool(v.Bool)
+	case ValueKindText:
+		return strconv.Quote(v.Text)
+	case ValueKindDatetime:
+		return "t" + strconv.Quote(FormatDatetime(v.Time))
+	case ValueKindBlob:
+		return "x'" + hex.EncodeToString(v.Bytes) + "'"
+	default:
+		return "null"
+	}
+}
+
+// Key returns a string that is equal for two values exactly when the values
+// are equal, suitable for use as a map key. Decimals compare by numeric
+// value, so "1.5" and "1.50" share a key.
+func (v Value) Key() string {
+	if v.Kind == ValueKindDecimal {
+		if r := v.Decimal.Rat(); r != nil {
+			return v.Kind.String() + ":" + r.RatString()
+		}
+	}
+	return v.Kind.String() + ":" + v.String()
+}
@@ -0,0 +1,52 @@
+package model
+
+// TablesInDependencyOrder returns the tables ordered so that every table
+// comes after the tables its foreign keys reference. Tables that are free to
+// go in any position keep their original relative order. A reference cycle
+// is broken at its first table in the original order.
+func (db *Database) TablesInDependencyOrder() []*Table {
+	placed := make(map[*Table]bool, len(db.Tables))
+	placedNames := make(map[string]bool, len(db.Tables))
+	out := make([]*Table, 0, len(db.Tables))
+
+	place := func(t *Table) {
+		placed[t] = true
+		placedNames[t.Name] = true
+		out = append(out, t)
+	}
+
+	ready := func(t *Table) bool {
+		for _, fk := range t.ForeignKeys {
+			if fk.ReferencedTable == t.Name {
+				continue
+			}
+			if _, exists := db.TableByName(fk.ReferencedTable); exists && !placedNames[fk.ReferencedTable] {
+				return false
+			}
+		}
+		return true
+	}
+
+	for len(out) < len(db.Tables) {
+		progressed := false
+		for _, t := range db.Tables {
+			if placed[t] || !ready(t) {
+				continue
+			}
+			place(t)
+			progressed = true
+		}
+
+		if !progressed {
+			// Break the cycle at the first unplaced table and carry on
+			for _, t := range db.Tables {
+				if !placed[t] {
+					place(t)
+					break
+				}
+			}
+		}
+	}
+
+	return out
+}
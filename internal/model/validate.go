@@ -0,0 +1,279 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ValidationError describes a single violation found by Database.Validate.
+// Row is 1-based and 0 when the violation is not tied to a row; Column is
+// empty when the violation concerns the whole row or table.
+type ValidationError struct {
+	Table   string
+	Row     int
+	Column  string
+	Message string
+}
+
+func (e ValidationError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "table %q", e.Table)
+	if e.Row > 0 {
+		fmt.Fprintf(&b, " row %d", e.Row)
+	}
+	if e.Column != "" {
+		fmt.Fprintf(&b, " column %q", e.Column)
+	}
+	b.WriteString(": ")
+	b.WriteString(e.Message)
+	return b.String()
+}
+
+// Validate checks every table against its own schema and returns all
+// violations found, table by table. Each table's are reported in the order
+// checked: its columns and keys, each index in turn, its rows, then enum
+// values, index names and foreign key targets. A nil result means the
+// database is valid.
+func (db *Database) Validate() []ValidationError {
+	var errs []ValidationError
+	indexNames := make(map[string]string)
+	for _, t := range db.Tables {
+		errs = append(errs, t.validate()...)
+		errs = append(errs, db.validateEnumColumns(t)...)
+		for _, idx := range t.Indexes {
+			// Index names share one namespace across the whole database
+			if other, dup := indexNames[idx.Name]; dup {
+				errs = append(errs, ValidationError{
+					Table:   t.Name,
+					Message: fmt.Sprintf("index %q is already declared on table %q", idx.Name, other),
+				})
+			}
+			indexNames[idx.Name] = t.Name
+		}
+		for _, fk := range t.ForeignKeys {
+			parent, ok := db.TableByName(fk.ReferencedTable)
+			if !ok {
+				errs = append(errs, ValidationError{
+					Table:   t.Name,
+					Column:  fk.Name,
+					Message: fmt.Sprintf("foreign key references unknown table %q", fk.ReferencedTable),
+				})
+				continue
+			}
+			if _, ok := parent.ColumnIndex(fk.ReferencedColumn); !ok {
+				errs = append(errs, ValidationError{
+					Table:   t.Name,
+					Column:  fk.Name,
+					Message: fmt.Sprintf("foreign key references unknown column %q of table %q", fk.ReferencedColumn, fk.ReferencedTable),
+				})
+			}
+		}
+	}
+	return errs
+}
+
+// validateEnumColumns checks that t's enum columns name a declared enum and
+// hold only that enum's values.
+func (db *Database) validateEnumColumns(t *Table) []ValidationError {
+	var errs []ValidationError
+	for ci, c := range t.Columns {
+		if c.Type != ColumnTypeEnum {
+			continue
+		}
+		e, ok := db.EnumByName(c.Enum)
+		if !ok {
+			errs = append(errs, ValidationError{
+				Table:   t.Name,
+				Column:  c.Name,
+				Message: fmt.Sprintf("column uses undeclared enum %q", c.Enum),
+			})
+			continue
+		}
+		if c.Default != nil && c.Default.Kind == ValueKindText && !e.Has(c.Default.Text) {
+			errs = append(errs, ValidationError{
+				Table:   t.Name,
+				Column:  c.Name,
+				Message: fmt.Sprintf("default %s is not in enum %q", c.Default, e.Name),
+			})
+		}
+		for ri, row := range t.Rows {
+			if ci >= len(row) || row[ci].Kind != ValueKindText || e.Has(row[ci].Text) {
+				continue
+			}
+			errs = append(errs, ValidationError{
+				Table:   t.Name,
+				Row:     ri + 1,
+				Column:  c.Name,
+				Message: fmt.Sprintf("value %s is not in enum %q", row[ci], e.Name),
+			})
+		}
+	}
+	return errs
+}
+
+func (t *Table) validate() []ValidationError {
+	var errs []ValidationError
+	report := func(row int, column, format string, args ...interface{}) {
+		errs = append(errs, ValidationError{
+			Table:   t.Name,
+			Row:     row,
+			Column:  column,
+			Message: fmt.Sprintf(format, args...),
+		})
+	}
+
+	seenCols := make(map[string]bool, len(t.Columns))
+	for _, c := range t.Columns {
+		if seenCols[c.Name] {
+			report(0, c.Name, "duplicate column name")
+		}
+		seenCols[c.Name] = true
+
+		if c.Default != nil {
+			if !c.Type.Accepts(c.Default.Kind) {
+				report(0, c.Name, "default %s does not match column type %s", c.Default, c.Type)
+			} else if c.NotNull && c.Default.Kind == ValueKindNull {
+				report(0, c.Name, "default is null but column is not null")
+			}
+		}
+	}
+
+	// First row (1-based) holding each value, per unique column
+	seenUnique := make(map[int]map[string]int)
+	for i, c := range t.Columns {
+		if c.Unique {
+			seenUnique[i] = make(map[string]int)
+		}
+	}
+
+	for _, name := range t.PK {
+		if _, ok := t.ColumnIndex(name); !ok {
+			report(0, name, "primary key names a column that does not exist")
+		}
+	}
+	pkIdx, hasPK := t.PKIndexes()
+	pkName := strings.Join(t.PK, ",")
+
+	for _, fk := range t.ForeignKeys {
+		if _, ok := t.ColumnIndex(fk.Name); !ok {
+			report(0, fk.Name, "foreign key names a column that does not exist")
+		}
+	}
+
+	for _, idx := range t.Indexes {
+		errs = append(errs, t.validateIndex(idx)...)
+	}
+
+	seenPKs := make(map[string]int)
+	for ri, row := range t.Rows {
+		rowNo := ri + 1
+
+		if len(row) != len(t.Columns) {
+			report(rowNo, "", "row has %d values but table has %d columns", len(row), len(t.Columns))
+		}
+
+		for ci, v := range row {
+			if ci >= len(t.Columns) {
+				break
+			}
+			c := t.Columns[ci]
+			if !c.Type.Accepts(v.Kind) {
+				report(rowNo, c.Name, "%s value does not match column type %s", v.Kind, c.Type)
+			}
+			if v.Kind == ValueKindNull {
+				if c.NotNull {
+					report(rowNo, c.Name, "null value in not-null column")
+				}
+				continue
+			}
+			if seen, ok := seenUnique[ci]; ok {
+				if first, dup := seen[v.Key()]; dup {
+					report(rowNo, c.Name, "duplicate value %s in unique column (first used in row %d)", v, first)
+				} else {
+					seen[v.Key()] = rowNo
+				}
+			}
+		}
+
+		if hasPK {
+			if rowHasNullAt(row, pkIdx) {
+				report(rowNo, pkName, "primary key is null")
+				continue
+			}
+			key := RowKey(row, pkIdx)
+			if first, dup := seenPKs[key]; dup {
+				report(rowNo, pkName, "duplicate primary key %s (first used in row %d)", formatKey(row, pkIdx), first)
+				continue
+			}
+			seenPKs[key] = rowNo
+		}
+	}
+
+	return errs
+}
+
+// validateIndex checks that idx names existing columns and, for a unique
+// index, that no two rows share the same non-null values.
+func (t *Table) validateIndex(idx Index) []ValidationError {
+	var errs []ValidationError
+	report := func(row int, format string, args ...interface{}) {
+		errs = append(errs, ValidationError{
+			Table:   t.Name,
+			Row:     row,
+			Column:  strings.Join(idx.Columns, ","),
+			Message: fmt.Sprintf(format, args...),
+		})
+	}
+
+	if len(idx.Columns) == 0 {
+		report(0, "index %q has no columns", idx.Name)
+		return errs
+	}
+	cols := make([]int, 0, len(idx.Columns))
+	for _, name := range idx.Columns {
+		i, ok := t.ColumnIndex(name)
+		if !ok {
+			report(0, "index %q names column %q that does not exist", idx.Name, name)
+			continue
+		}
+		cols = append(cols, i)
+	}
+	if len(cols) != len(idx.Columns) || !idx.Unique {
+		return errs
+	}
+
+	seen := make(map[string]int)
+	for ri, row := range t.Rows {
+		// As in SQL, rows with a null in the key never collide
+		if rowHasNullAt(row, cols) {
+			continue
+		}
+		key := RowKey(row, cols)
+		if first, dup := seen[key]; dup {
+			report(ri+1, "duplicate value %s in unique index %q (first used in row %d)", formatKey(row, cols), idx.Name, first)
+			continue
+		}
+		seen[key] = ri + 1
+	}
+	return errs
+}
+
+func rowHasNullAt(row Row, idx []int) bool {
+	for _, i := range idx {
+		if i >= len(row) || row[i].Kind == ValueKindNull {
+			return true
+		}
+	}
+	return false
+}
+
+func formatKey(row Row, idx []int) string {
+	parts := make([]string, 0, len(idx))
+	for _, i := range idx {
+		parts = append(parts, row[i].String())
+	}
+	if len(parts) == 1 {
+		return parts[0]
+	}
+	return "(" + strings.Join(parts, ", ") + ")"
+}
@@ -0,0 +1,234 @@
+package model
+
+import (
+	"testing"
+)
+
+func TestValidateReportsEveryViolation(t *testing.T) {
+	db := &Database{
+		Tables: []*Table{
+			{
+				Name:    "people",
+				Columns: []Column{{Name: "id", Type: ColumnTypeInt}, {Name: "name", Type: ColumnTypeText}},
+				PK:      []string{"id"},
+				Rows: []Row{
+					{IntValue(1), TextValue("Matt")},
+					{IntValue(1), TextValue("Calvert")},
+					{TextValue("two"), TextValue("X")},
+					{IntValue(3)},
+				},
+			},
+			{
+				Name:    "tags",
+				Columns: []Column{{Name: "slug", Type: ColumnTypeText}},
+				PK:      []string{"id"},
+			},
+		},
+	}
+
+	errs := db.Validate()
+
+	want := []ValidationError{
+		{Table: "people", Row: 2, Column: "id"},
+		{Table: "people", Row: 3, Column: "id"},
+		{Table: "people", Row: 4, Column: ""},
+		{Table: "tags", Row: 0, Column: "id"},
+	}
+	if len(errs) != len(want) {
+		t.Fatalf("expected %d errors, got %d: %v", len(want), len(errs), errs)
+	}
+	for i, w := range want {
+		if errs[i].Table != w.Table || errs[i].Row != w.Row || errs[i].Column != w.Column {
+			t.Errorf("error %d: expected %s/%d/%s, got %v", i, w.Table, w.Row, w.Column, errs[i])
+		}
+	}
+}
+
+func TestValidateAcceptsValidDatabase(t *testing.T) {
+	db := &Database{
+		Tables: []*Table{
+			{
+				Name:    "prices",
+				Columns: []Column{{Name: "id", Type: ColumnTypeInt}, {Name: "amount", Type: ColumnTypeDecimal}},
+				PK:      []string{"id"},
+				Rows: []Row{
+					{IntValue(1), DecimalValue("1.50")},
+					{IntValue(2), IntValue(3)},
+					{IntValue(3), NullValue()},
+				},
+			},
+		},
+	}
+
+	if errs := db.Validate(); len(errs) != 0 {
+		t.Fatalf("expected no errors, got %v", errs)
+	}
+}
+
+func TestValidateColumnConstraints(t *testing.T) {
+	defaultOf := func(v Value) *Value { return &v }
+
+	tests := []struct {
+		name    string
+		column  Column
+		rows    []Row
+		wantRow int
+	}{
+		{
+			name:    "null in not-null column",
+			column:  Column{Name: "v", Type: ColumnTypeText, NotNull: true},
+			rows:    []Row{{IntValue(1), TextValue("a")}, {IntValue(2), NullValue()}},
+			wantRow: 2,
+		},
+		{
+			name:    "duplicate in unique column",
+			column:  Column{Name: "v", Type: ColumnTypeText, Unique: true},
+			rows:    []Row{{IntValue(1), TextValue("a")}, {IntValue(2), NullValue()}, {IntValue(3), TextValue("a")}},
+			wantRow: 3,
+		},
+		{
+			name:    "mistyped default",
+			column:  Column{Name: "v", Type: ColumnTypeInt, Default: defaultOf(TextValue("x"))},
+			rows:    []Row{{IntValue(1), IntValue(1)}},
+			wantRow: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := &Database{
+				Tables: []*Table{
+					{
+						Name:    "items",
+						Columns: []Column{{Name: "id", Type: ColumnTypeInt}, tt.column},
+						PK:      []string{"id"},
+						Rows:    tt.rows,
+					},
+				},
+			}
+
+			errs := db.Validate()
+			if len(errs) != 1 {
+				t.Fatalf("expected 1 error, got %d: %v", len(errs), errs)
+			}
+			if errs[0].Table != "items" || errs[0].Row != tt.wantRow || errs[0].Column != "v" {
+				t.Errorf("expected items/%d/v, got %v", tt.wantRow, errs[0])
+			}
+		})
+	}
+}
+
+func TestValidateEnumColumns(t *testing.T) {
+	db := &Database{
+		Enums: []Enum{{Name: "status", Values: []string{"draft", "live"}}},
+		Tables: []*Table{
+			{
+				Name: "posts",
+				Columns: []Column{
+					{Name: "status", Type: ColumnTypeEnum, Enum: "status"},
+					{Name: "kind", Type: ColumnTypeEnum, Enum: "kind"},
+				},
+				Rows: []Row{
+					{TextValue("live"), NullValue()},
+					{TextValue("gone"), NullValue()},
+				},
+			},
+		},
+	}
+
+	errs := db.Validate()
+	want := []ValidationError{
+		{Table: "posts", Row: 2, Column: "status"},
+		{Table: "posts", Row: 0, Column: "kind"},
+	}
+	if len(errs) != len(want) {
+		t.Fatalf("expected %d errors, got %d: %v", len(want), len(errs), errs)
+	}
+	for _, w := range want {
+		found := false
+		for _, e := range errs {
+			if e.Table == w.Table && e.Row == w.Row && e.Column == w.Column {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("expected an error for %s/%d/%s, got %v", w.Table, w.Row, w.Column, errs)
+		}
+	}
+}
+
+func TestValidateIndexes(t *testing.T) {
+	db := &Database{
+		Tables: []*Table{
+			{
+				Name:    "people",
+				Columns: []Column{{Name: "id", Type: ColumnTypeInt}, {Name: "email", Type: ColumnTypeText}},
+				Indexes: []Index{
+					{Name: "idx_email", Columns: []string{"email"}, Unique: true},
+					{Name: "idx_missing", Columns: []string{"phone"}},
+				},
+				Rows: []Row{
+					{IntValue(1), TextValue("a@example.com")},
+					{IntValue(2), NullValue()},
+					{IntValue(3), NullValue()},
+					{IntValue(4), TextValue("a@example.com")},
+				},
+			},
+			{
+				Name:    "posts",
+				Columns: []Column{{Name: "email", Type: ColumnTypeText}},
+				Indexes: []Index{{Name: "idx_email", Columns: []string{"email"}}},
+			},
+		},
+	}
+
+	errs := db.Validate()
+	want := []ValidationError{
+		{Table: "people", Row: 4, Column: "email"},
+		{Table: "people", Row: 0, Column: "phone"},
+		{Table: "posts", Row: 0, Column: ""},
+	}
+	if len(errs) != len(want) {
+		t.Fatalf("expected %d errors, got %d: %v", len(want), len(errs), errs)
+	}
+	for i, w := range want {
+		if errs[i].Table != w.Table || errs[i].Row != w.Row || errs[i].Column != w.Column {
+			t.Errorf("error %d: expected %s/%d/%s, got %v", i, w.Table, w.Row, w.Column, errs[i])
+		}
+	}
+}
+
+func TestValidateForeignKeyTargets(t *testing.T) {
+	db := &Database{
+		Tables: []*Table{
+			{
+				Name:    "people",
+				Columns: []Column{{Name: "id", Type: ColumnTypeInt}},
+				PK:      []string{"id"},
+			},
+			{
+				Name:    "posts",
+				Columns: []Column{{Name: "author_id", Type: ColumnTypeInt}, {Name: "editor_id", Type: ColumnTypeInt}, {Name: "tag_id", Type: ColumnTypeInt}},
+				ForeignKeys: []ForeignKey{
+					{Name: "author_id", ReferencedTable: "people", ReferencedColumn: "id"},
+					{Name: "editor_id", ReferencedTable: "people", ReferencedColumn: "key"},
+					{Name: "tag_id", ReferencedTable: "tags", ReferencedColumn: "id"},
+				},
+			},
+		},
+	}
+
+	errs := db.Validate()
+	want := []ValidationError{
+		{Table: "posts", Column: "editor_id"},
+		{Table: "posts", Column: "tag_id"},
+	}
+	if len(errs) != len(want) {
+		t.Fatalf("expected %d errors, got %d: %v", len(want), len(errs), errs)
+	}
+	for i, w := range want {
+		if errs[i].Table != w.Table || errs[i].Row != 0 || errs[i].Column != w.Column {
+			t.Errorf("error %d: expected %s/0/%s, got %v", i, w.Table, w.Column, errs[i])
+		}
+	}
+}
@@ -8,7 +8,9 @@ import (
 	"sqlon/internal/format/sqlon"
 )
 
-type JSONToSQLONStep struct{}
+type JSONToSQLONStep struct {
+	Options json.ImportOptions
+}
 
 func (s *JSONToSQLONStep) Name() string {
 	return "JSON → SQLON"
@@ -19,7 +21,7 @@ func (s *JSONToSQLONStep) Ext() string {
 }
 
 func (s *JSONToSQLONStep) Run(in []byte) ([]byte, error) {
-	db, err := json.Import(bytes.NewReader(in))
+	db, err := json.ImportWithOptions(bytes.NewReader(in), s.Options)
 	if err != nil {
 		return nil, err
 	}
@@ -31,7 +33,9 @@ func (s *JSONToSQLONStep) Run(in []byte) ([]byte, error) {
 	return buf.Bytes(), nil
 }
 
-type SQLONToSQLStep struct{}
+type SQLONToSQLStep struct {
+	Options sql.ExportOptions
+}
 
 func (s *SQLONToSQLStep) Name() string {
 	return "SQLON → SQL (SQLite)"
@@ -48,7 +52,7 @@ func (s *SQLONToSQLStep) Run(in []byte) ([]byte, error) {
 	}
 
 	var buf bytes.Buffer
-	if err := sql.ExportSQLite(&buf, db); err != nil {
+	if err := sql.ExportSQLiteWithOptions(&buf, db, s.Options); err != nil {
 		return nil, err
 	}
 	return buf.Bytes(), nil